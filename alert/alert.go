@@ -0,0 +1,237 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/search"
+	"github.com/RomanLorens/logviewer-module/utils"
+)
+
+//maxFired fired alerts kept for listing
+var maxFired = 100
+
+//sampleLines matching lines sent with alert
+var sampleLines = 5
+
+//Alerter evaluates rules against lines appended to logs since previous run and sends alerts
+//to sinks of rules
+type Alerter struct {
+	logger l.Logger
+	host   string
+	run    sync.Mutex
+	mu     sync.RWMutex
+	rules  []*rule
+	fired  []model.Alert
+	now    func() time.Time
+}
+
+//rule state of alert rule, hits are records matched per run within window
+type rule struct {
+	model.AlertRule
+	sinks     []Sink
+	follower  *search.Follower
+	hits      []hit
+	active    bool
+	lastFired time.Time
+	err       error
+}
+
+//hit records matched by run with last sampleLines of their lines
+type hit struct {
+	at     time.Time
+	count  int
+	sample []string
+}
+
+//NewAlerter new alerter
+func NewAlerter(logger l.Logger) *Alerter {
+	host, _ := utils.Hostname()
+	return &Alerter{logger: logger, host: host, now: time.Now}
+}
+
+//LoadRules reads rules from json file
+func LoadRules(path string) ([]model.AlertRule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read alert rules, %v", err)
+	}
+	var rules []model.AlertRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("Could not parse alert rules %v, %v", path, err)
+	}
+	return rules, nil
+}
+
+//AddRule validates rule and starts evaluating it, only records appended from now on are counted
+func (a *Alerter) AddRule(r model.AlertRule) error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("Missing rule name")
+	case r.Log == "":
+		return fmt.Errorf("Missing log of rule %v", r.Name)
+	case r.Pattern == "" && r.Level == "":
+		return fmt.Errorf("Rule %v needs pattern or level", r.Name)
+	case r.WindowSec <= 0:
+		return fmt.Errorf("Invalid window %v of rule %v", r.WindowSec, r.Name)
+	case r.Threshold < 0 || r.CooldownSec < 0:
+		return fmt.Errorf("Invalid threshold or cooldown of rule %v", r.Name)
+	}
+	if len(r.Sinks) == 0 {
+		r.Sinks = []model.AlertSink{{Type: model.AlertSinkStdout}}
+	}
+	sinks := make([]Sink, 0, len(r.Sinks))
+	for _, cfg := range r.Sinks {
+		s, err := NewSink(cfg)
+		if err != nil {
+			return fmt.Errorf("Invalid sink of rule %v, %v", r.Name, err)
+		}
+		sinks = append(sinks, s)
+	}
+	if r.Pattern != "" {
+		if _, err := search.NewMatcher(r.Pattern, r.Mode, r.CaseSensitive); err != nil {
+			return fmt.Errorf("Invalid pattern of rule %v, %v", r.Name, err)
+		}
+	}
+	if r.Level != "" && r.LogStructure == nil {
+		return fmt.Errorf("Rule %v by level needs log structure", r.Name)
+	}
+	ru := &rule{AlertRule: r, sinks: sinks}
+	//log which does not exist yet is followed once it is created
+	ru.follower, ru.err = search.NewFollowerAtEnd(ru.request())
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, x := range a.rules {
+		if x.Name == r.Name {
+			return fmt.Errorf("Rule %v already exists", r.Name)
+		}
+	}
+	a.rules = append(a.rules, ru)
+	return nil
+}
+
+func (r *rule) request() *model.LogRequest {
+	return &model.LogRequest{Log: r.Log, LogStructure: r.LogStructure, Filter: &model.TailFilter{
+		Value: r.Pattern, Mode: r.Mode, CaseSensitive: r.CaseSensitive, Level: r.Level}}
+}
+
+//Run evaluates rules, it is scheduler task
+func (a *Alerter) Run(ctx context.Context) {
+	a.run.Lock()
+	defer a.run.Unlock()
+	a.mu.RLock()
+	rules := append([]*rule(nil), a.rules...)
+	a.mu.RUnlock()
+	for _, r := range rules {
+		alert, err := a.evaluate(r)
+		a.mu.Lock()
+		r.err = err
+		if alert != nil {
+			a.fired = append([]model.Alert{*alert}, a.fired...)
+			if len(a.fired) > maxFired {
+				a.fired = a.fired[:maxFired]
+			}
+		}
+		a.mu.Unlock()
+		if err != nil {
+			a.logger.Error(ctx, "Could not evaluate alert rule %v, %v", r.Name, err)
+			continue
+		}
+		if alert != nil {
+			a.logger.Info(ctx, "Alert %v fired, %v records of %v in %vs", r.Name, alert.Count, r.Log, r.WindowSec)
+			a.dispatch(ctx, r, alert)
+		}
+	}
+}
+
+//evaluate counts records appended since previous run, returns alert when rule fires
+func (a *Alerter) evaluate(r *rule) (*model.Alert, error) {
+	now := a.now()
+	if r.follower == nil {
+		f, err := search.NewFollowerAtEnd(r.request())
+		if err != nil {
+			return nil, err
+		}
+		r.follower = f
+	}
+	count := 0
+	var sample []string
+	for {
+		res, err := r.follower.Next()
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			break
+		}
+		count += res.Records
+		sample = append(sample, res.Lines...)
+		if len(sample) > sampleLines {
+			sample = sample[len(sample)-sampleLines:]
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if count > 0 {
+		r.hits = append(r.hits, hit{at: now, count: count, sample: sample})
+	}
+	window := time.Duration(r.WindowSec) * time.Second
+	for len(r.hits) > 0 && now.Sub(r.hits[0].at) >= window {
+		r.hits = r.hits[1:]
+	}
+	total := 0
+	sample = nil
+	for _, h := range r.hits {
+		total += h.count
+		sample = append(sample, h.sample...)
+	}
+	if len(sample) > sampleLines {
+		sample = sample[len(sample)-sampleLines:]
+	}
+	r.active = total > r.Threshold
+	if !r.active || (!r.lastFired.IsZero() && now.Sub(r.lastFired) < time.Duration(r.CooldownSec)*time.Second) {
+		return nil, nil
+	}
+	r.lastFired = now
+	return &model.Alert{Rule: r.Name, Log: r.Log, Host: a.host, Count: total, Threshold: r.Threshold,
+		WindowSec: r.WindowSec, Time: now.UnixNano() / int64(time.Millisecond), Lines: sample}, nil
+}
+
+func (a *Alerter) dispatch(ctx context.Context, r *rule, alert *model.Alert) {
+	for i, s := range r.sinks {
+		if err := s.Send(ctx, alert); err != nil {
+			a.logger.Error(ctx, "Could not send alert %v to %v sink, %v", r.Name, r.Sinks[i].Type, err)
+		}
+	}
+}
+
+//Status rules with their state and alerts fired recently
+func (a *Alerter) Status() *model.AlertsResponse {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	now := a.now()
+	res := &model.AlertsResponse{Rules: make([]model.AlertRuleState, 0, len(a.rules)), Fired: append([]model.Alert{}, a.fired...)}
+	for _, r := range a.rules {
+		st := model.AlertRuleState{Rule: r.AlertRule, Active: r.active}
+		window := time.Duration(r.WindowSec) * time.Second
+		for _, h := range r.hits {
+			if now.Sub(h.at) < window {
+				st.Count += h.count
+			}
+		}
+		if !r.lastFired.IsZero() {
+			st.LastFired = r.lastFired.UnixNano() / int64(time.Millisecond)
+		}
+		if r.err != nil {
+			st.Error = r.err.Error()
+		}
+		res.Rules = append(res.Rules, st)
+	}
+	return res
+}
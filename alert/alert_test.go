@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+func TestAlerter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(path, []byte("2021-05-06 11:27:58,453|exec-1|ERROR|AppExceptionHandler|ab12345|req-0|old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hooks := make(chan model.Alert, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a model.Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		hooks <- a
+	}))
+	defer webhook.Close()
+
+	a := NewAlerter(log.PrintLogger(false))
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	sinkFile := filepath.Join(dir, "alerts.json")
+	err = a.AddRule(model.AlertRule{Name: "app errors", Log: path, Pattern: "ERROR.*AppExceptionHandler", Mode: "regex",
+		Threshold: 2, WindowSec: 300, CooldownSec: 60,
+		Sinks: []model.AlertSink{{Type: model.AlertSinkWebhook, URL: webhook.URL}, {Type: model.AlertSinkFile, Path: sinkFile}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.AddRule(model.AlertRule{Name: "levels", Log: path, Level: "ERROR", WindowSec: 60}); err == nil {
+		t.Fatal("expected level rule without log structure to fail")
+	}
+	write := func(n int) {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		for i := 0; i < n; i++ {
+			f.WriteString("2021-05-06 11:27:58,455|exec-1|ERROR|AppExceptionHandler|ab12345|req-1|failed\n")
+			f.WriteString("2021-05-06 11:27:58,456|exec-1|INFO|LogFilter|ab12345|req-1|done\n")
+		}
+		f.Close()
+	}
+	ctx := context.Background()
+	write(2)
+	a.Run(ctx)
+	if st := a.Status(); st.Rules[0].Count != 2 || st.Rules[0].Active || len(st.Fired) != 0 {
+		t.Fatalf("expected 2 records under threshold, got %+v", st)
+	}
+	now = now.Add(time.Minute)
+	write(1)
+	a.Run(ctx)
+	select {
+	case alert := <-hooks:
+		if alert.Rule != "app errors" || alert.Count != 3 || len(alert.Lines) != 3 {
+			t.Fatalf("unexpected alert %+v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected alert posted to webhook")
+	}
+	st := a.Status()
+	if !st.Rules[0].Active || len(st.Fired) != 1 || st.Rules[0].LastFired == 0 {
+		t.Fatalf("expected active rule with fired alert, got %+v", st)
+	}
+
+	//cooldown
+	now = now.Add(30 * time.Second)
+	write(1)
+	a.Run(ctx)
+	if len(a.Status().Fired) != 1 {
+		t.Fatal("expected no alert within cooldown")
+	}
+	//window passed
+	now = now.Add(10 * time.Minute)
+	a.Run(ctx)
+	if st := a.Status(); st.Rules[0].Active || st.Rules[0].Count != 0 {
+		t.Fatalf("expected rule to recover after window, got %+v", st.Rules[0])
+	}
+
+	f, err := os.Open(sinkFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+	}
+	if lines != 1 {
+		t.Fatalf("expected 1 alert in file, got %v", lines)
+	}
+
+	//lines of records which left window are not sampled
+	write(3)
+	a.Run(ctx)
+	select {
+	case alert := <-hooks:
+		if alert.Count != 3 || len(alert.Lines) != 3 {
+			t.Fatalf("expected lines of records within window only, got %+v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected alert posted to webhook")
+	}
+}
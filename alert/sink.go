@@ -0,0 +1,97 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//webhookTimeout timeout of webhook call
+var webhookTimeout = 10 * time.Second
+
+//Sink sends alerts
+type Sink interface {
+	Send(ctx context.Context, alert *model.Alert) error
+}
+
+//NewSink sink of config
+func NewSink(cfg model.AlertSink) (Sink, error) {
+	switch cfg.Type {
+	case model.AlertSinkWebhook:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("Missing webhook url")
+		}
+		return &webhookSink{url: cfg.URL, client: &http.Client{Timeout: webhookTimeout}}, nil
+	case model.AlertSinkFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("Missing file path")
+		}
+		return &fileSink{path: cfg.Path}, nil
+	case model.AlertSinkStdout:
+		return &writerSink{w: os.Stdout}, nil
+	}
+	return nil, fmt.Errorf("Unknown sink type %v", cfg.Type)
+}
+
+//webhookSink posts alert as json
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Send(ctx context.Context, alert *model.Alert) error {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("Could not create request for %v, %v", s.url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error from client %v, %v", s.url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Status from %v - %v", s.url, res.StatusCode)
+	}
+	return nil
+}
+
+//fileSink appends alert as json line
+type fileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileSink) Send(ctx context.Context, alert *model.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open %v, %v", s.path, err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(alert)
+}
+
+//writerSink prints alert
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Send(ctx context.Context, alert *model.Alert) error {
+	_, err := fmt.Fprintf(s.w, "ALERT %v: %v records of %v on %v in last %vs, threshold %v\n",
+		alert.Rule, alert.Count, alert.Log, alert.Host, alert.WindowSec, alert.Threshold)
+	return err
+}
@@ -5,23 +5,46 @@ import (
 
 	l "github.com/RomanLorens/logger/log"
 	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/profile"
 	"github.com/RomanLorens/logviewer-module/search"
 	"github.com/RomanLorens/logviewer-module/stat"
 )
 
-//LocalAPI local api
+//LocalAPI local api, profiles of requests are resolved on copies of requests
 type LocalAPI struct {
-	logger l.Logger
+	logger   l.Logger
+	profiles *profile.Registry
 }
 
 //NewLocalAPI api
 func NewLocalAPI(logger l.Logger) *LocalAPI {
-	return &LocalAPI{logger: logger}
+	return &LocalAPI{logger: logger, profiles: profile.NewRegistry()}
+}
+
+//SetProfiles replaces registry of profiles, api has registry of presets only by default
+func (la *LocalAPI) SetProfiles(p *profile.Registry) {
+	la.profiles = p
 }
 
 //Grep greps log
-func (la LocalAPI) Grep(ctx context.Context, req *model.GrepRequest) []model.GrepResponse {
-	return search.Grep(ctx, req, la.logger)
+func (la LocalAPI) Grep(ctx context.Context, req *model.GrepRequest) ([]model.GrepResponse, error) {
+	r := *req
+	if err := la.profiles.Resolve(r.Profile, &r.LogStructure); err != nil {
+		return nil, err
+	}
+	return search.Grep(ctx, &r, la.logger)
+}
+
+//Trace trace request id across logs
+func (la LocalAPI) Trace(ctx context.Context, req *model.TraceRequest) (*model.TraceResponse, error) {
+	r := *req
+	r.Logs = append([]model.TraceLog(nil), req.Logs...)
+	for i := range r.Logs {
+		if err := la.profiles.Resolve(r.Logs[i].Profile, &r.Logs[i].LogStructure); err != nil {
+			return nil, err
+		}
+	}
+	return search.Trace(ctx, &r, la.logger)
 }
 
 //ListLogs list logs
@@ -36,22 +59,86 @@ func (la LocalAPI) DownloadLog(log string) ([]byte, error) {
 }
 
 //TailLog tail log
-func (la LocalAPI) TailLog(ctx context.Context, log string) (*model.TailLogResponse, error) {
+func (la LocalAPI) TailLog(ctx context.Context, req *model.LogRequest) (*model.TailLogResponse, error) {
 	la.logger.Info(ctx, "Tail logs locally")
-	return search.Tail(log)
+	r := *req
+	if err := la.profiles.Resolve(r.Profile, &r.LogStructure); err != nil {
+		return nil, err
+	}
+	return search.Tail(&r)
+}
+
+//Read read lines by line number or offset
+func (la LocalAPI) Read(ctx context.Context, req *model.ReadRequest) (*model.ReadResponse, error) {
+	return search.Read(req)
+}
+
+//DetectStructure proposes log structure of log
+func (la LocalAPI) DetectStructure(ctx context.Context, req *model.DetectRequest) (*model.DetectResponse, error) {
+	return search.DetectStructure(req)
 }
 
 //Stats stats
 func (la LocalAPI) Stats(ctx context.Context, req *model.StatsRequest) (map[string]*model.Stat, error) {
-	return stat.Stats(req.Log, req.LogStructure)
+	r, err := la.statsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return stat.Stats(r)
+}
+
+//ErrorGroups errors grouped by fingerprint
+func (la LocalAPI) ErrorGroups(ctx context.Context, req *model.ErrorGroupsRequest) (*model.ErrorGroupsPagination, error) {
+	r := *req
+	if req.StatsRequest != nil {
+		sr, err := la.statsRequest(req.StatsRequest)
+		if err != nil {
+			return nil, err
+		}
+		r.StatsRequest = sr
+	}
+	return stat.ErrorGroups(&r)
+}
+
+//Histogram record counts per time bucket and level
+func (la LocalAPI) Histogram(ctx context.Context, req *model.HistogramRequest) (*model.HistogramResponse, error) {
+	r := *req
+	if err := la.profiles.Resolve(r.Profile, &r.LogStructure); err != nil {
+		return nil, err
+	}
+	return stat.Histogram(&r)
 }
 
 //Errors errors
 func (la LocalAPI) Errors(ctx context.Context, req *model.ErrorsRequest) (*model.ErrorDetailsPagination, error) {
-	return stat.Errors(req)
+	r := *req
+	sr, err := la.statsRequest(req.StatsRequest)
+	if err != nil {
+		return nil, err
+	}
+	r.StatsRequest = sr
+	return stat.Errors(&r)
 }
 
 //CollectStats collect stats
 func (la LocalAPI) CollectStats(ctx context.Context, req *model.CollectStatsRequest) (*model.CollectStatsRsults, error) {
-	return stat.CollectStats(ctx, req, la.logger)
+	r := *req
+	sr, err := la.statsRequest(req.StatsRequest)
+	if err != nil {
+		return nil, err
+	}
+	r.StatsRequest = sr
+	return stat.CollectStats(ctx, &r, la.logger)
+}
+
+//statsRequest copy of stats request with log structure of its profile
+func (la LocalAPI) statsRequest(req *model.StatsRequest) (*model.StatsRequest, error) {
+	if req == nil {
+		return nil, nil
+	}
+	r := *req
+	if err := la.profiles.Resolve(r.Profile, &r.LogStructure); err != nil {
+		return nil, err
+	}
+	return &r, nil
 }
@@ -2,8 +2,11 @@ package api
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	l "github.com/RomanLorens/logger/log"
 	"github.com/RomanLorens/logviewer-module/model"
@@ -13,11 +16,16 @@ var (
 	la  = NewLocalAPI(l.PrintLogger(false))
 	log = "../test-logs/java-app.log"
 	ls  = model.LogStructure{Date: 0, User: 4, Reqid: 5, Level: 2, Message: 6, DateFormat: "2006-01-02"}
+
+	javaLs = model.LogStructure{Date: 0, User: 4, Reqid: 5, Level: 2, Message: 6, JavaDateFormat: "yyyy-MM-dd HH:mm:ss,SSS"}
 )
 
 func TestGrep(t *testing.T) {
-	res := la.Grep(context.Background(), &model.GrepRequest{Value: "1-01-CV-QCVMW9XPMLMMUMJKKJNTCR1ETMKB9EG133396101@1-248129#6", Logs: []string{log}})
+	res, err := la.Grep(context.Background(), &model.GrepRequest{Value: "1-01-CV-QCVMW9XPMLMMUMJKKJNTCR1ETMKB9EG133396101@1-248129#6", Logs: []string{log}})
 
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(res) != 1 {
 		t.Fatal("empty response")
 	}
@@ -26,6 +34,36 @@ func TestGrep(t *testing.T) {
 	}
 }
 
+func TestGrepBoolean(t *testing.T) {
+	res, err := la.Grep(context.Background(), &model.GrepRequest{Value: "ERROR AND bc23456 NOT \"exeption any\"",
+		Mode: model.QueryBoolean, Logs: []string{log}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || len(res[0].Lines) != 2 {
+		t.Fatalf("expected 2 lines, got %v", res)
+	}
+}
+
+func TestGrepErrors(t *testing.T) {
+	missing := "../test-logs/missing.log"
+	res, err := la.Grep(context.Background(), &model.GrepRequest{Value: "AppExceptionHandler", Logs: []string{log, missing}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].LogFile != log || res[1].LogFile != missing {
+		t.Fatalf("expected response for every log in order, got %v", res)
+	}
+	if res[0].Error != "" || len(res[0].Lines) != 2 || res[0].Host == "" {
+		t.Errorf("expected 2 matches with host, got %v", res[0])
+	}
+	if res[1].Error == "" {
+		t.Errorf("expected error for %v", missing)
+	}
+}
+
 func TestListLogs(t *testing.T) {
 	res := la.ListLogs(context.Background(), &model.ListLogsRequest{Logs: []string{log}})
 
@@ -46,7 +84,7 @@ func TestDownloadLog(t *testing.T) {
 }
 
 func TestTailLog(t *testing.T) {
-	res, err := la.TailLog(context.Background(), log)
+	res, err := la.TailLog(context.Background(), &model.LogRequest{Log: log})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,6 +93,16 @@ func TestTailLog(t *testing.T) {
 	}
 }
 
+func TestDetectStructure(t *testing.T) {
+	res, err := la.DetectStructure(context.Background(), &model.DetectRequest{Log: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.LogStructure.Level != ls.Level || res.LogStructure.Message != ls.Message || res.Confidence["level"] == 0 {
+		t.Errorf("expected structure like %+v, got %+v", ls, res.LogStructure)
+	}
+}
+
 func TestStats(t *testing.T) {
 	stats, err := la.Stats(context.Background(), &model.StatsRequest{Log: log, LogStructure: &ls})
 
@@ -66,6 +114,88 @@ func TestStats(t *testing.T) {
 	}
 }
 
+func TestHistogram(t *testing.T) {
+	res, err := la.Histogram(context.Background(), &model.HistogramRequest{Log: log, LogStructure: &javaLs, Interval: model.HistogramHour,
+		FromTime: time.Date(2021, 5, 6, 7, 0, 0, 0, time.Local).UnixNano() / 1e6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Buckets) != 5 || res.Buckets[0].Total != 3 || res.Buckets[4].Total != 44 || res.Buckets[1].Total != 0 {
+		t.Fatalf("expected 5 hour buckets from 07:00 to 11:00, got %+v", res.Buckets)
+	}
+	if res.Buckets[4].Levels["INFO"] != 44 || len(res.Buckets[1].Levels) != 0 {
+		t.Errorf("expected counts by level, got %+v", res.Buckets)
+	}
+
+	res, err = la.Histogram(context.Background(), &model.HistogramRequest{Log: log, LogStructure: &javaLs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, b := range res.Buckets {
+		total += b.Total
+	}
+	if res.Interval != model.HistogramDay || len(res.Buckets) != 11 || total != 57 || res.Buckets[0].Levels["ERROR"] != 6 {
+		t.Errorf("expected auto day buckets of all records, got %v %+v", res.Interval, res.Buckets)
+	}
+	if _, err = la.Histogram(context.Background(), &model.HistogramRequest{Log: log, LogStructure: &javaLs, Interval: "week"}); err == nil {
+		t.Error("expected unknown interval to fail")
+	}
+}
+
+func TestHistogramDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	local := time.Local
+	time.Local = ny
+	defer func() { time.Local = local }()
+	f, err := ioutil.TempFile("", "histogram-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`2021-11-07 00:30:00 -0400|exec-1|INFO|Job|ab12345|req-1|start
+2021-11-07 01:30:00 -0400|exec-1|INFO|Job|ab12345|req-2|before fall back
+2021-11-07 01:30:00 -0500|exec-1|ERROR|Job|ab12345|req-3|after fall back
+2021-11-07 02:30:00 -0500|exec-1|INFO|Job|ab12345|req-4|end
+`)
+	f.Close()
+	dls := model.LogStructure{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6, DateFormat: "2006-01-02 15:04:05 -0700"}
+	res, err := la.Histogram(context.Background(), &model.HistogramRequest{Log: f.Name(), LogStructure: &dls, Interval: model.HistogramHour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Buckets) != 4 || res.Buckets[2].Levels["ERROR"] != 1 || res.Buckets[2].Time-res.Buckets[1].Time != time.Hour.Milliseconds() {
+		t.Errorf("expected repeated hour to have its own bucket, got %+v", res.Buckets)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	req := &model.StatsRequest{Log: log, Profile: "log4j-pipe"}
+	for i := 0; i < 2; i++ {
+		stats, err := la.Stats(context.Background(), req)
+		if err != nil || len(stats) == 0 {
+			t.Fatalf("expected stats of log with preset, got %v %v", stats, err)
+		}
+	}
+	if req.LogStructure != nil {
+		t.Error("expected request of caller not to be changed")
+	}
+	errs, err := la.Errors(context.Background(), &model.ErrorsRequest{StatsRequest: req, Size: 10})
+	if err != nil || len(errs.ErrorDetails) == 0 {
+		t.Errorf("expected errors of log with preset, got %+v %v", errs, err)
+	}
+	h, err := la.Histogram(context.Background(), &model.HistogramRequest{Log: log, Profile: "log4j-pipe"})
+	if err != nil || len(h.Buckets) == 0 {
+		t.Errorf("expected histogram of log with preset, got %+v %v", h, err)
+	}
+	if _, err = la.Stats(context.Background(), &model.StatsRequest{Log: log, Profile: "missing"}); err == nil {
+		t.Error("expected unknown profile to fail")
+	}
+}
+
 func TestErrors(t *testing.T) {
 	r := model.ErrorsRequest{StatsRequest: &model.StatsRequest{Log: log, LogStructure: &ls}, From: 0, Size: 100}
 	res, err := la.Errors(context.Background(), &r)
@@ -89,3 +219,223 @@ func TestCollectStats(t *testing.T) {
 		t.Error("empty res")
 	}
 }
+
+func TestCollectStatsDay(t *testing.T) {
+	req := &model.StatsRequest{Log: log, LogStructure: &javaLs}
+	day, err := la.CollectStats(context.Background(), &model.CollectStatsRequest{StatsRequest: req, Date: "2021-04-26"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := la.CollectStats(context.Background(), &model.CollectStatsRequest{StatsRequest: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if day.TotalRequests == 0 || day.TotalRequests >= all.TotalRequests {
+		t.Errorf("expected requests of 2021-04-26 only, got %v of %v", day.TotalRequests, all.TotalRequests)
+	}
+	//date not in date format is matched as text of record date
+	text, err := la.CollectStats(context.Background(), &model.CollectStatsRequest{StatsRequest: req, Date: "04-26 10:29"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.TotalRequests != day.TotalRequests {
+		t.Errorf("expected %v requests matching date text, got %v", day.TotalRequests, text.TotalRequests)
+	}
+}
+
+func TestCollectStatsWithoutDateFormat(t *testing.T) {
+	noDate := ls
+	noDate.DateFormat = ""
+	req := &model.StatsRequest{Log: log, LogStructure: &noDate}
+	stats, err := la.CollectStats(context.Background(), &model.CollectStatsRequest{StatsRequest: req, Date: "2021-04-26"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Users) == 0 {
+		t.Error("expected stats of records containing date")
+	}
+	none, err := la.CollectStats(context.Background(), &model.CollectStatsRequest{StatsRequest: req, Date: "2021/02/18"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none.Users) != 0 {
+		t.Errorf("expected no stats of other date, got %v", none.Users)
+	}
+}
+
+func TestErrorsTimeRange(t *testing.T) {
+	from := time.Date(2021, 4, 26, 10, 29, 50, 785*int(time.Millisecond), time.Local)
+	r := model.ErrorsRequest{StatsRequest: &model.StatsRequest{Log: log, LogStructure: &javaLs,
+		FromTime: from.UnixNano() / int64(time.Millisecond), ToTime: from.Add(time.Millisecond).UnixNano() / int64(time.Millisecond)},
+		From: 0, Size: 100}
+	res, err := la.Errors(context.Background(), &r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ErrorDetails) != 1 || res.ErrorDetails[0].Date != "2021-04-26 10:29:50,785" {
+		t.Errorf("expected 1 error at %v, got %v", from, res.ErrorDetails)
+	}
+}
+
+func TestErrorsStackTrace(t *testing.T) {
+	f, err := ioutil.TempFile("", "errors-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`2021-05-06 11:27:58,455|exec-1|ERROR|AppExceptionHandler|ab12345|req-1|failed
+java.lang.NullPointerException: null
+	at com.app.Service.run(Service.java:42)
+2021-05-06 11:27:58,460|exec-1|INFO|LogFilter|ab12345|req-1|done
+`)
+	f.Close()
+
+	r := model.ErrorsRequest{StatsRequest: &model.StatsRequest{Log: f.Name(), LogStructure: &ls}, From: 0, Size: 100}
+	res, err := la.Errors(context.Background(), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ErrorDetails) != 1 || !strings.Contains(res.ErrorDetails[0].Message, "Service.java:42") {
+		t.Errorf("expected error with stack trace, got %v", res.ErrorDetails)
+	}
+}
+
+func TestErrorGroups(t *testing.T) {
+	res, err := la.ErrorGroups(context.Background(), &model.ErrorGroupsRequest{StatsRequest: &model.StatsRequest{Log: log, LogStructure: &javaLs}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pagination.Total != 3 || len(res.Groups) != 3 {
+		t.Fatalf("expected 3 groups of errors, got %+v", res.Groups)
+	}
+	for _, g := range res.Groups {
+		if g.Count != 2 || g.UserCount != 2 || g.SampleReqID == "" || g.FirstSeen == "" {
+			t.Errorf("expected group of 2 errors of 2 users, got %+v", g)
+		}
+	}
+
+	f, err := ioutil.TempFile("", "groups-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`2021-05-06 11:00:00,001|exec-1|ERROR|Handler|ab12345|req-1|Order 1001 failed for f47ac10b-58cc-4372-a567-0e02b2c3d479 GET /orders?id=1001
+java.lang.NullPointerException: null
+	at com.app.Service.run(Service.java:42)
+2021-05-06 11:30:00,001|exec-2|ERROR|Handler|cd67890|req-2|Order 2002 failed for 9c5b94b1-35ad-49bb-b118-8e8fc24abf80 GET /orders?id=2002
+java.lang.NullPointerException: null
+	at com.app.Service.run(Service.java:43)
+2021-05-06 11:40:00,001|exec-2|ERROR|Handler|cd67890|req-3|Order 3003 failed for 9c5b94b1-35ad-49bb-b118-8e8fc24abf80 GET /orders?id=3003
+java.lang.IllegalStateException: closed
+	at com.app.Repository.save(Repository.java:7)
+2021-05-06 12:00:00,001|exec-1|WARN|Handler|ab12345|req-4|Slow request req-4 took 0x1f ms
+`)
+	f.Close()
+	req := &model.ErrorGroupsRequest{StatsRequest: &model.StatsRequest{Log: f.Name(), LogStructure: &javaLs}}
+	if res, err = la.ErrorGroups(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	g := res.Groups[0]
+	if len(res.Groups) != 3 || g.Count != 2 || g.Message != "Order <n> failed for <uuid> GET /orders?<query>" ||
+		g.LastSeen != "2021-05-06 11:30:00,001" || len(g.Users) != 2 || g.Trend[0] != 1 || g.Trend[11] != 1 {
+		t.Fatalf("expected records with same message and stack trace grouped, got %+v", res.Groups)
+	}
+	for _, w := range res.Groups[1:] {
+		if w.Level == "WARN" && w.Message != "Slow request <reqid> took <hex> ms" {
+			t.Errorf("expected normalized warning, got %+v", w)
+		}
+	}
+	req.Sort, req.Size, req.From = model.ErrorGroupsByLastSeen, 1, 1
+	if res, err = la.ErrorGroups(context.Background(), req); err != nil || len(res.Groups) != 1 || res.Groups[0].Sample != "Order 3003 failed for 9c5b94b1-35ad-49bb-b118-8e8fc24abf80 GET /orders?id=3003" {
+		t.Errorf("expected second group seen last, got %+v %v", res, err)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	f, err := ioutil.TempFile("", "stats-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"time":"2021-05-06T11:27:58Z","level":"INFO","user":"ab12345","reqid":"req-1","msg":"start"}
+{"time":"2021-05-06T11:27:59Z","level":"ERROR","user":"ab12345","reqid":"req-1","msg":"failed"}
+{"time":"2021-05-06T11:28:00Z","level":"INFO","user":"cd67890","reqid":"req-2","msg":"start"}
+not json
+`)
+	f.Close()
+
+	jls := model.LogStructure{Format: model.FormatJSON, DateFormat: "2006-01-02T15:04:05Z07:00"}
+	stats, err := la.Stats(context.Background(), &model.StatsRequest{Log: f.Name(), LogStructure: &jls,
+		FromTime: time.Date(2021, 5, 6, 11, 27, 59, 0, time.UTC).UnixNano() / int64(time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats["ab12345"].Counter != 1 || len(stats["ab12345"].Errors) != 1 || stats["cd67890"].Counter != 1 {
+		t.Errorf("expected records from 11:27:59 per user, got %v", stats)
+	}
+}
+
+func TestErrorsRegexFormat(t *testing.T) {
+	f, err := ioutil.TempFile("", "errors-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`2021-05-06 11:27:58,455 ERROR [exec-1] ab12345 req-1 AppExceptionHandler - failed
+java.lang.NullPointerException: null
+	at com.app.Service.run(Service.java:42)
+2021-05-06 11:27:58,460 INFO  [exec-1] ab12345 req-1 LogFilter - done
+`)
+	f.Close()
+
+	rls := model.LogStructure{Format: model.FormatRegex, DateFormat: "2006-01-02 15:04:05,000",
+		Pattern: `^(?P<date>\S+ \S+) +(?P<level>[A-Z]+) +\[[^\]]*\] (?P<user>\S+) (?P<reqid>\S+) (?P<message>.*)$`}
+	r := model.ErrorsRequest{StatsRequest: &model.StatsRequest{Log: f.Name(), LogStructure: &rls}, From: 0, Size: 100}
+	res, err := la.Errors(context.Background(), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ErrorDetails) != 1 || res.ErrorDetails[0].ReqID.ReqID != "req-1" || !strings.Contains(res.ErrorDetails[0].Message, "Service.java:42") {
+		t.Errorf("expected error with stack trace, got %v", res.ErrorDetails)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	app, err := ioutil.TempFile("", "app-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(app.Name())
+	app.WriteString(`2021-05-06 11:27:58,100|exec-1|INFO|LogFilter|ab12345|req-1|start
+2021-05-06 11:27:58,150|exec-2|INFO|LogFilter|ab12345|req-2|start
+2021-05-06 11:27:58,900|exec-1|INFO|LogFilter|ab12345|req-1|done
+`)
+	app.Close()
+	client, err := ioutil.TempFile("", "client-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(client.Name())
+	client.WriteString(`req-1|2021-05-06 11:27:58,400|GET /downstream took 300ms
+`)
+	client.Close()
+
+	res, err := la.Trace(context.Background(), &model.TraceRequest{ReqID: "req-1", Logs: []model.TraceLog{
+		{Log: app.Name(), LogStructure: &javaLs},
+		{Log: client.Name(), LogStructure: &model.LogStructure{Date: 1, Reqid: 0, User: -1, Level: -1, Message: 2, JavaDateFormat: "yyyy-MM-dd HH:mm:ss,SSS"}},
+		{Log: "missing.log"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Steps) != 3 || res.Steps[1].Log != client.Name() {
+		t.Fatalf("expected 3 steps with client call in the middle, got %+v", res.Steps)
+	}
+	if res.Steps[1].Elapsed != 300 || res.Steps[2].Elapsed != 500 || res.Steps[2].SinceStart != 800 || res.Duration != 800 {
+		t.Errorf("unexpected durations %+v", res)
+	}
+	if res.Errors["missing.log"] == "" {
+		t.Errorf("expected error for missing log structure, got %v", res.Errors)
+	}
+}
@@ -5,21 +5,104 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"time"
 
 	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/alert"
+	"github.com/RomanLorens/logviewer-module/index"
 	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/profile"
 	"github.com/RomanLorens/logviewer-module/search"
 	"github.com/RomanLorens/logviewer-module/stat"
 )
 
 //Handler handler
 type Handler struct {
-	logger l.Logger
+	logger      l.Logger
+	indexer     *index.Indexer
+	alerter     *alert.Alerter
+	tails       *search.Hub
+	profiles    *profile.Registry
+	idleTimeout time.Duration
 }
 
+//defaultIdleTimeout live tail session without new lines is closed after
+const defaultIdleTimeout = 30 * time.Minute
+
 //NewHandler new handler
 func NewHandler(logger l.Logger) *Handler {
-	return &Handler{logger: logger}
+	return &Handler{logger: logger, tails: search.NewHub(logger), profiles: profile.NewRegistry(), idleTimeout: defaultIdleTimeout}
+}
+
+//SetProfiles replaces registry of profiles, handler has registry of presets only by default
+func (h *Handler) SetProfiles(p *profile.Registry) {
+	h.profiles = p
+}
+
+//SetIdleTimeout live tail session is closed when nothing is appended to log for d
+func (h *Handler) SetIdleTimeout(d time.Duration) {
+	h.idleTimeout = d
+}
+
+//SetIndexer enables index endpoint
+func (h *Handler) SetIndexer(ix *index.Indexer) {
+	h.indexer = ix
+}
+
+//SetAlerter enables alerts endpoint
+func (h *Handler) SetAlerter(a *alert.Alerter) {
+	h.alerter = a
+}
+
+//Alerts alert rules with their state and fired alerts
+func (h Handler) Alerts(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if h.alerter == nil {
+		return nil, fmt.Errorf("Alerting is not enabled")
+	}
+	return h.alerter.Status(), nil
+}
+
+//Profiles lists profiles, POST saves profile and DELETE deletes profile of name query parameter
+func (h Handler) Profiles(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		var p model.Profile
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			return nil, fmt.Errorf("Could not parse req body as profile, %v", err)
+		}
+		if err := h.profiles.Save(p); err != nil {
+			return nil, err
+		}
+		h.logger.Info(r.Context(), "Saved profile %v", p.Name)
+		return p, nil
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if err := h.profiles.Delete(name); err != nil {
+			return nil, err
+		}
+		h.logger.Info(r.Context(), "Deleted profile %v", name)
+		return nil, nil
+	}
+	return h.profiles.List(), nil
+}
+
+//Index starts indexing log in background and keeps its index up to date, GET returns index status
+//of log query parameter
+func (h Handler) Index(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if h.indexer == nil {
+		return nil, fmt.Errorf("Indexing is not enabled")
+	}
+	if r.Method == http.MethodGet {
+		return h.indexer.Status(r.URL.Query().Get("log"))
+	}
+	var req model.IndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("Could not parse req body as index request, %v", err)
+	}
+	if err := h.profiles.Resolve(req.Profile, &req.LogStructure); err != nil {
+		return nil, err
+	}
+	return h.indexer.Start(r.Context(), req.Log, req.LogStructure)
 }
 
 //DownloadLog download log
@@ -48,7 +131,10 @@ func (h Handler) Stats(w http.ResponseWriter, r *http.Request) (interface{}, err
 	if err != nil {
 		return nil, fmt.Errorf("Could not parse req body as stats request, %v", err)
 	}
-	return stat.Stats(sr.Log, sr.LogStructure)
+	if err := h.profiles.Resolve(sr.Profile, &sr.LogStructure); err != nil {
+		return nil, err
+	}
+	return stat.Stats(&sr)
 }
 
 //CollectStats collect stats
@@ -58,9 +144,42 @@ func (h Handler) CollectStats(w http.ResponseWriter, r *http.Request) (interface
 	if err != nil {
 		return nil, fmt.Errorf("Could not parse req body, %v", err)
 	}
+	if s.StatsRequest != nil {
+		if err := h.profiles.Resolve(s.Profile, &s.LogStructure); err != nil {
+			return nil, err
+		}
+	}
 	return stat.CollectStats(r.Context(), &s, h.logger)
 }
 
+//ErrorGroups errors grouped by fingerprint
+func (h Handler) ErrorGroups(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var req model.ErrorGroupsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse req body as error groups req, %v", err)
+	}
+	if req.StatsRequest != nil {
+		if err := h.profiles.Resolve(req.Profile, &req.LogStructure); err != nil {
+			return nil, err
+		}
+	}
+	return stat.ErrorGroups(&req)
+}
+
+//Histogram record counts per time bucket and level
+func (h Handler) Histogram(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var req model.HistogramRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse req body as histogram req, %v", err)
+	}
+	if err := h.profiles.Resolve(req.Profile, &req.LogStructure); err != nil {
+		return nil, err
+	}
+	return stat.Histogram(&req)
+}
+
 //Errors errors
 func (h Handler) Errors(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	var req model.ErrorsRequest
@@ -68,6 +187,11 @@ func (h Handler) Errors(w http.ResponseWriter, r *http.Request) (interface{}, er
 	if err != nil {
 		return nil, fmt.Errorf("Could not parse req body as errors req, %v", err)
 	}
+	if req.StatsRequest != nil {
+		if err := h.profiles.Resolve(req.Profile, &req.LogStructure); err != nil {
+			return nil, err
+		}
+	}
 	return stat.Errors(&req)
 }
 
@@ -78,7 +202,30 @@ func (h Handler) TailLog(w http.ResponseWriter, r *http.Request) (interface{}, e
 	if err != nil {
 		return nil, fmt.Errorf("Could not parse req body as log req, %v", err)
 	}
-	return search.Tail(req.Log)
+	if err := h.profiles.Resolve(req.Profile, &req.LogStructure); err != nil {
+		return nil, err
+	}
+	return search.Tail(&req)
+}
+
+//DetectStructure proposes log structure of log
+func (h Handler) DetectStructure(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var req model.DetectRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse req body as detect structure req, %v", err)
+	}
+	return search.DetectStructure(&req)
+}
+
+//Read read lines by line number or offset
+func (h Handler) Read(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var req model.ReadRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse req body as read req, %v", err)
+	}
+	return search.Read(&req)
 }
 
 //ListLogs list logs
@@ -99,5 +246,58 @@ func (h Handler) Search(w http.ResponseWriter, r *http.Request) (interface{}, er
 	if err != nil {
 		return nil, err
 	}
-	return search.Grep(r.Context(), &gr, h.logger), nil
+	if err := h.profiles.Resolve(gr.Profile, &gr.LogStructure); err != nil {
+		return nil, err
+	}
+	return search.Grep(r.Context(), &gr, h.logger)
+}
+
+//Trace trace request id across logs
+func (h Handler) Trace(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var tr model.TraceRequest
+	err := json.NewDecoder(r.Body).Decode(&tr)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse req body as trace request, %v", err)
+	}
+	for i := range tr.Logs {
+		if err := h.profiles.Resolve(tr.Logs[i].Profile, &tr.Logs[i].LogStructure); err != nil {
+			return nil, err
+		}
+	}
+	return search.Trace(r.Context(), &tr, h.logger)
+}
+
+//SearchStream search streaming matches and progress as ndjson events
+func (h Handler) SearchStream(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var gr model.GrepRequest
+	err := json.NewDecoder(r.Body).Decode(&gr)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.profiles.Resolve(gr.Profile, &gr.LogStructure); err != nil {
+		return nil, err
+	}
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	written := false
+	err = search.GrepStream(r.Context(), &gr, h.logger, func(e *model.GrepEvent) error {
+		if !written {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			written = true
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !written {
+		return nil, err
+	}
+	if err != nil {
+		h.logger.Info(r.Context(), "Search stream stopped, %v", err)
+	}
+	return nil, nil
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+func TestSearchStream(t *testing.T) {
+	body, _ := json.Marshal(model.GrepRequest{Value: "AppExceptionHandler", Logs: []string{"../test-logs/java-app.log"}})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/lv/"+model.SearchStreamEndpoint, bytes.NewReader(body))
+
+	if _, err := h.SearchStream(w, r); err != nil {
+		t.Fatal(err)
+	}
+	events := make([]model.GrepEvent, 0)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var e model.GrepEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event %v, %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	matches := 0
+	for _, e := range events {
+		if e.Type == model.GrepEventMatch {
+			matches++
+		}
+	}
+	if matches != 2 {
+		t.Errorf("expected 2 matches, got %v", events)
+	}
+	last := events[len(events)-1]
+	if last.Type != model.GrepEventDone {
+		t.Errorf("expected done event last, got %v", last)
+	}
+	progress := events[len(events)-2]
+	if progress.Type != model.GrepEventProgress || progress.Scanned != progress.Total || progress.Total == 0 {
+		t.Errorf("expected complete progress, got %v", progress)
+	}
+}
+
+func TestTailLogStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(log, []byte("a|INFO|one\nb|INFO|two\nc|INFO|three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.TailLogStream(w, r)
+	}))
+	defer s.Close()
+
+	r, _ := http.NewRequest("GET", s.URL+"?log="+url.QueryEscape(log), nil)
+	r.Header.Set("Last-Event-ID", "11")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %v", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	next := func() (string, *model.TailLogResponse) {
+		id, res := "", &model.TailLogResponse{}
+		for {
+			l, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case strings.HasPrefix(l, "id: "):
+				id = strings.TrimSpace(l[4:])
+			case strings.HasPrefix(l, "data: "):
+				if err := json.Unmarshal([]byte(l[6:]), res); err != nil {
+					t.Fatal(err)
+				}
+			case l == "\n" && id != "":
+				return id, res
+			}
+		}
+	}
+	if id, res := next(); !strings.HasSuffix(id, "35") || !reflect.DeepEqual(res.Lines, []string{"b|INFO|two", "c|INFO|three"}) {
+		t.Fatalf("expected to resume after first line, got %v %v", id, res.Lines)
+	}
+	f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("d|INFO|four\n")
+	f.Close()
+	if id, res := next(); !strings.HasSuffix(id, "47") || !reflect.DeepEqual(res.Lines, []string{"d|INFO|four"}) {
+		t.Fatalf("expected appended line, got %v %v", id, res.Lines)
+	}
+}
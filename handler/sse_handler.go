@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/search"
+)
+
+//sseKeepAlive interval of comments keeping idle stream open through proxies
+var sseKeepAlive = 15 * time.Second
+
+//TailLogStream tails log as server sent events, id of every event is identity of file and offset
+//in it after its lines so reconnecting client sending Last-Event-ID resumes where it stopped, or
+//from start of log rotated meanwhile
+func (h Handler) TailLogStream(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	req, err := tailStreamRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.profiles.Resolve(req.Profile, &req.LogStructure); err != nil {
+		return nil, err
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("Streaming is not supported")
+	}
+	ctx := r.Context()
+	var sub *search.Subscription
+	var res *model.TailLogResponse
+	if id := lastEventID(r); id != "" {
+		file, offset, err := parseEventID(id)
+		if err != nil {
+			return nil, err
+		}
+		h.logger.Info(ctx, "Resuming tail of %v from %v", req.Log, offset)
+		sub, res, err = h.tails.Resume(ctx, req, file, offset)
+	} else {
+		sub, res, err = h.tails.Subscribe(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := writeEvent(w, res, sub.File()); err != nil {
+		return nil, nil
+	}
+	flusher.Flush()
+	idle := time.Now()
+	for {
+		next, cancel := context.WithTimeout(ctx, sseKeepAlive)
+		res, err := sub.Next(next)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return nil, nil
+		case err == context.DeadlineExceeded:
+			if time.Since(idle) >= h.idleTimeout {
+				h.logger.Info(ctx, "Nothing appended to %v for %v - closing stream", req.Log, h.idleTimeout)
+				return nil, nil
+			}
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case err != nil:
+			h.logger.Error(ctx, "Error from tail %v", err)
+			return nil, nil
+		default:
+			idle = time.Now()
+			err = writeEvent(w, res, sub.File())
+		}
+		if err != nil {
+			h.logger.Info(ctx, "Closing stream - %v", err)
+			return nil, nil
+		}
+		flusher.Flush()
+	}
+}
+
+//tailStreamRequest log request from body of POST or from query of GET sent by EventSource
+func tailStreamRequest(r *http.Request) (*model.LogRequest, error) {
+	var req model.LogRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, fmt.Errorf("Could not parse req body as log req, %v", err)
+		}
+		return &req, nil
+	}
+	q := r.URL.Query()
+	req.Log = q.Get("log")
+	if req.Log == "" {
+		return nil, fmt.Errorf("Missing log")
+	}
+	if v := q.Get("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid lines %v", v)
+		}
+		req.Lines = n
+	}
+	req.Profile = q.Get("profile")
+	if v := q.Get("logStructure"); v != "" {
+		if err := json.Unmarshal([]byte(v), &req.LogStructure); err != nil {
+			return nil, fmt.Errorf("Could not parse log structure, %v", err)
+		}
+	}
+	tf := model.TailFilter{Value: q.Get("filter"), Mode: q.Get("mode"), CaseSensitive: q.Get("caseSensitive") == "true",
+		Level: q.Get("level"), User: q.Get("user"), ReqID: q.Get("reqid")}
+	if tf.Value != "" || tf.Level != "" || tf.User != "" || tf.ReqID != "" {
+		req.Filter = &tf
+	}
+	return &req, nil
+}
+
+//lastEventID id of last event received by reconnecting client, query parameter is for clients
+//which can not set headers
+func lastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("lastEventId")
+}
+
+//parseEventID file identity and offset of event id file:offset, file is empty for id of offset only
+func parseEventID(id string) (string, int64, error) {
+	file := ""
+	if i := strings.LastIndexByte(id, ':'); i >= 0 {
+		file, id = id[:i], id[i+1:]
+	}
+	offset, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || offset < 0 {
+		return "", 0, fmt.Errorf("Invalid Last-Event-ID %v", id)
+	}
+	return file, offset, nil
+}
+
+//writeEvent writes response as unnamed event with id of file and offset, rotation and truncation
+//are reported by its event field
+func writeEvent(w http.ResponseWriter, res *model.TailLogResponse, file string) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	id := strconv.FormatInt(res.Offset, 10)
+	if file != "" {
+		id = file + ":" + id
+	}
+	_, err = fmt.Fprintf(w, "id: %v\ndata: %s\n\n", id, b)
+	return err
+}
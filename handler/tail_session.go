@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/utils"
+	"github.com/gorilla/websocket"
+)
+
+//sessionQueue frames waiting for slow client, subscriptions stop reading when it is full
+//and catch up from disk later
+var sessionQueue = 16
+
+//TailSessionWS tails multiple logs of local and remote hosts over single websocket, client sends
+//subscribe, unsubscribe, pause and resume messages, every pushed frame has id, log and host
+func (h Handler) TailSessionWS(w http.ResponseWriter, r *http.Request) error {
+	c, er := upgrader.Upgrade(w, r, nil)
+	if er != nil {
+		return fmt.Errorf("Could not create websocket, %v", er)
+	}
+	defer h.closeWS(r.Context(), c)
+	h.logger.Info(r.Context(), "Accepted tail session from %v", r.RemoteAddr)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	host, _ := utils.Hostname()
+	s := &tailSession{h: h, host: host, out: make(chan *model.TailFrame, sessionQueue), subs: make(map[string]*sessionSub)}
+
+	in := make(chan []byte)
+	go func(c *websocket.Conn) {
+		defer utils.CatchError(ctx, h.logger)
+		for {
+			_, p, err := c.ReadMessage()
+			if err != nil {
+				h.logger.Info(ctx, "Closing tail session - %v", err)
+				cancel()
+				return
+			}
+			select {
+			case in <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(c)
+
+	idle := time.NewTimer(h.idleTimeout)
+	defer idle.Stop()
+	for {
+		var f *model.TailFrame
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-idle.C:
+			h.logger.Info(ctx, "Tail session idle for %v - closing connection", h.idleTimeout)
+			return nil
+		case p := <-in:
+			var m model.TailMessage
+			if err := json.Unmarshal(p, &m); err != nil {
+				f = &model.TailFrame{Type: model.TailFrameError, Error: fmt.Sprintf("Could not parse message, %v", err)}
+			} else {
+				f = s.handle(ctx, &m)
+			}
+		case f = <-s.out:
+		}
+		if !idle.Stop() {
+			<-idle.C
+		}
+		idle.Reset(h.idleTimeout)
+		if err := c.WriteJSON(f); err != nil {
+			return fmt.Errorf("Could not write tail frame, %v", err)
+		}
+		if f.Type == model.TailFrameSubscribed {
+			s.acked(f.ID)
+		}
+	}
+}
+
+type tailSession struct {
+	h    Handler
+	host string
+	out  chan *model.TailFrame
+	mu   sync.Mutex
+	subs map[string]*sessionSub
+}
+
+//sessionSub subscription of session, paused subscription waits until resume is closed, lines
+//are pushed once subscribed acknowledgement was written and ack is closed
+type sessionSub struct {
+	cancel context.CancelFunc
+	ack    chan struct{}
+	mu     sync.Mutex
+	resume chan struct{}
+}
+
+//handle handles client message, returns its acknowledgement
+func (s *tailSession) handle(ctx context.Context, m *model.TailMessage) *model.TailFrame {
+	id := m.ID
+	log := ""
+	if m.Request != nil {
+		log = m.Request.Log
+	}
+	if id == "" {
+		id = log
+		if m.Host != "" {
+			id = m.Host + "|" + log
+		}
+	}
+	ack := &model.TailFrame{ID: id, Log: log, Host: m.Host}
+	if ack.Host == "" {
+		ack.Host = s.host
+	}
+	fail := func(format string, args ...interface{}) *model.TailFrame {
+		ack.Type, ack.Error = model.TailFrameError, fmt.Sprintf(format, args...)
+		return ack
+	}
+	if id == "" {
+		return fail("Missing subscription id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	switch m.Type {
+	case model.TailSubscribe:
+		if ok {
+			return fail("Already subscribed to %v", id)
+		}
+		if log == "" {
+			return fail("Missing log")
+		}
+		sub = &sessionSub{ack: make(chan struct{})}
+		var subCtx context.Context
+		subCtx, sub.cancel = context.WithCancel(ctx)
+		s.subs[id] = sub
+		ack.Type = model.TailFrameSubscribed
+		go s.pump(subCtx, sub, ack, m.Host, m.Request)
+	case model.TailUnsubscribe, model.TailPause, model.TailResume:
+		if !ok {
+			return fail("Not subscribed to %v", id)
+		}
+		switch m.Type {
+		case model.TailUnsubscribe:
+			delete(s.subs, id)
+			sub.cancel()
+			ack.Type = model.TailFrameUnsubscribed
+		case model.TailPause:
+			sub.pause()
+			ack.Type = model.TailFramePaused
+		default:
+			sub.unpause()
+			ack.Type = model.TailFrameResumed
+		}
+	default:
+		return fail("Unknown message type %v", m.Type)
+	}
+	return ack
+}
+
+//pump pushes lines of subscription to session until it is unsubscribed or fails
+func (s *tailSession) pump(ctx context.Context, sub *sessionSub, ack *model.TailFrame, host string, req *model.LogRequest) {
+	defer utils.CatchError(ctx, s.h.logger)
+	select {
+	case <-sub.ack:
+	case <-ctx.Done():
+		return
+	}
+	var err error
+	if host == "" || host == s.host {
+		err = s.local(ctx, sub, ack, req)
+	} else {
+		err = s.remote(ctx, sub, ack, host, req)
+	}
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	s.h.logger.Error(ctx, "Tail of %v failed, %v", ack.ID, err)
+	s.mu.Lock()
+	if s.subs[ack.ID] == sub {
+		delete(s.subs, ack.ID)
+	}
+	s.mu.Unlock()
+	s.send(ctx, &model.TailFrame{Type: model.TailFrameError, ID: ack.ID, Log: ack.Log, Host: ack.Host, Error: err.Error()})
+}
+
+func (s *tailSession) local(ctx context.Context, sub *sessionSub, ack *model.TailFrame, req *model.LogRequest) error {
+	lr := *req
+	if err := s.h.profiles.Resolve(lr.Profile, &lr.LogStructure); err != nil {
+		return err
+	}
+	subscription, res, err := s.h.tails.Subscribe(ctx, &lr)
+	if err != nil {
+		return err
+	}
+	defer subscription.Close()
+	for {
+		res.Host = ack.Host
+		if !sub.wait(ctx) || !s.send(ctx, &model.TailFrame{Type: model.TailFrameLines, ID: ack.ID, Log: ack.Log, Host: ack.Host, Tail: res}) {
+			return nil
+		}
+		if res, err = subscription.Next(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+//remote relays tail stream of remote host, paused relay stops reading so remote host
+//stops reading log too
+func (s *tailSession) remote(ctx context.Context, sub *sessionSub, ack *model.TailFrame, host string, req *model.LogRequest) error {
+	url := host
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	url = strings.TrimSuffix(url, "/") + "/lv/" + model.TailLogStreamEndpoint
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Could not create request for %v, %v", url, err)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("Error from client %v, %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Status from %v - %v", url, resp.StatusCode)
+	}
+	events := bufio.NewReader(resp.Body)
+	for {
+		res, err := readEvent(events)
+		if err != nil {
+			return fmt.Errorf("Could not read tail of %v, %v", url, err)
+		}
+		res.Host = ack.Host
+		if !sub.wait(ctx) || !s.send(ctx, &model.TailFrame{Type: model.TailFrameLines, ID: ack.ID, Log: ack.Log, Host: ack.Host, Tail: res}) {
+			return nil
+		}
+	}
+}
+
+//readEvent reads data of next server sent event, comments are skipped
+func readEvent(r *bufio.Reader) (*model.TailLogResponse, error) {
+	var data []byte
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l = strings.TrimRight(l, "\r\n")
+		switch {
+		case strings.HasPrefix(l, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(l, "data:"), " ")...)
+		case l == "" && data != nil:
+			var res model.TailLogResponse
+			if err := json.Unmarshal(data, &res); err != nil {
+				return nil, err
+			}
+			return &res, nil
+		}
+	}
+}
+
+//acked starts pushing lines of subscription whose subscribed acknowledgement was written
+func (s *tailSession) acked(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub, ok := s.subs[id]; ok {
+		select {
+		case <-sub.ack:
+		default:
+			close(sub.ack)
+		}
+	}
+}
+
+//send queues frame for client, blocks while client is slow
+func (s *tailSession) send(ctx context.Context, f *model.TailFrame) bool {
+	select {
+	case s.out <- f:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (sub *sessionSub) pause() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.resume == nil {
+		sub.resume = make(chan struct{})
+	}
+}
+
+func (sub *sessionSub) unpause() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.resume != nil {
+		close(sub.resume)
+		sub.resume = nil
+	}
+}
+
+//wait waits while subscription is paused, lines read meanwhile are sent after resume and
+//the rest is read from log then, false when subscription was stopped
+func (sub *sessionSub) wait(ctx context.Context) bool {
+	sub.mu.Lock()
+	resume := sub.resume
+	sub.mu.Unlock()
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return ctx.Err() == nil
+}
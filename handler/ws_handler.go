@@ -28,72 +28,97 @@ type Health struct {
 	Status int
 }
 
-//TailLogWS tail logs
+//TailLogWS tails log and pushes lines appended to it until client leaves or session is idle
+//longer than idle timeout
 func (h Handler) TailLogWS(w http.ResponseWriter, r *http.Request) error {
 	c, er := upgrader.Upgrade(w, r, nil)
 	if er != nil {
 		return fmt.Errorf("Could not create websocket, %v", er)
 	}
-	ticker := time.NewTicker(5 * time.Second)
-	defer func() {
-		ticker.Stop()
-		h.closeWS(r.Context(), c)
-	}()
+	defer h.closeWS(r.Context(), c)
 	h.logger.Info(r.Context(), "Accepted ws connection from %v", r.RemoteAddr)
 	var lr model.LogRequest
-	done := make(chan bool)
 	if er := c.ReadJSON(&lr); er != nil {
-		<-done
 		return fmt.Errorf("Could not parse incoming request, %v", er)
 	}
-
+	if er := h.profiles.Resolve(lr.Profile, &lr.LogStructure); er != nil {
+		return er
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
 	go func(c *websocket.Conn) {
-		utils.CatchError(r.Context(), h.logger)
-		res, err := search.Tail(lr.Log)
-		if err != nil {
-			h.logger.Error(r.Context(), "Error from tail %v", err)
-			done <- true
-			return
-		}
-		c.WriteJSON(res)
-		modtime := res.ModTime
-		i := 0
+		defer utils.CatchError(ctx, h.logger)
 		for {
-			select {
-			case <-ticker.C:
-				h.logger.Info(r.Context(), "tail logs ticker %v - modtime %v", i, modtime)
-				i++
-				res, isNeeded, err := search.TailLogIfNewer(lr.Log, modtime)
-				if err != nil {
-					h.logger.Error(r.Context(), "Error from tail %v", err)
-					done <- true
-					break
-				}
-				if !isNeeded {
-					h.logger.Info(r.Context(), "%v was not modified since %v", lr.Log, modtime)
-					continue
-				}
-				modtime = res.ModTime
-				c.WriteJSON(res)
-				if i >= 100 {
-					h.logger.Info(r.Context(), "timeout limit for ws ticker reached - closing connection")
-					done <- true
-					break
-				}
+			if _, _, err := c.ReadMessage(); err != nil {
+				h.logger.Info(ctx, "Closing connection - %v", err)
+				cancel()
+				return
 			}
 		}
 	}(c)
 
+	sub, res, err := h.tails.Subscribe(ctx, &lr)
+	if err != nil {
+		return fmt.Errorf("Error from tail %v", err)
+	}
+	defer sub.Close()
+	if err := c.WriteJSON(res); err != nil {
+		return fmt.Errorf("Could not write tail response, %v", err)
+	}
+	for {
+		next, cancelNext := context.WithTimeout(ctx, h.idleTimeout)
+		res, err := sub.Next(next)
+		cancelNext()
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err == context.DeadlineExceeded:
+			h.logger.Info(ctx, "Nothing appended to %v for %v - closing connection", lr.Log, h.idleTimeout)
+			return nil
+		case err != nil:
+			return fmt.Errorf("Error from tail %v", err)
+		}
+		if err := c.WriteJSON(res); err != nil {
+			return fmt.Errorf("Could not write tail response, %v", err)
+		}
+	}
+}
+
+//SearchWS streams search matches and progress over websocket, search stops when client disconnects
+func (h Handler) SearchWS(w http.ResponseWriter, r *http.Request) error {
+	c, er := upgrader.Upgrade(w, r, nil)
+	if er != nil {
+		return fmt.Errorf("Could not create websocket, %v", er)
+	}
+	defer h.closeWS(r.Context(), c)
+	h.logger.Info(r.Context(), "Accepted search ws connection from %v", r.RemoteAddr)
+	var gr model.GrepRequest
+	if er := c.ReadJSON(&gr); er != nil {
+		return fmt.Errorf("Could not parse incoming request, %v", er)
+	}
+	if er := h.profiles.Resolve(gr.Profile, &gr.LogStructure); er != nil {
+		return er
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
 	go func(c *websocket.Conn) {
-		utils.CatchError(r.Context(), h.logger)
-		_, _, err := c.ReadMessage()
-		if err != nil {
-			h.logger.Info(r.Context(), "Closing connection - %v", err)
-			done <- true
+		defer utils.CatchError(ctx, h.logger)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				h.logger.Info(ctx, "Closing search connection - %v", err)
+				cancel()
+				return
+			}
 		}
 	}(c)
 
-	<-done
+	err := search.GrepStream(ctx, &gr, h.logger, func(e *model.GrepEvent) error {
+		return c.WriteJSON(e)
+	})
+	if err != nil && ctx.Err() == nil {
+		c.WriteJSON(&model.GrepEvent{Type: model.GrepEventError, Error: err.Error()})
+		return fmt.Errorf("Search failed, %v", err)
+	}
 	return nil
 }
 
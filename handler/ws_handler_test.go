@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -44,3 +47,131 @@ func TestWSTailLog(t *testing.T) {
 
 	ws.Close()
 }
+
+func TestWSSearch(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.SearchWS(w, r)
+	}))
+	defer s.Close()
+	u := "ws" + strings.TrimPrefix(s.URL, "http")
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer ws.Close()
+
+	if err := ws.WriteJSON(model.GrepRequest{Value: "AppExceptionHandler", Logs: []string{"../test-logs/java-app.log"}}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	matches := 0
+	for {
+		var e model.GrepEvent
+		if err := ws.ReadJSON(&e); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if e.Type == model.GrepEventMatch {
+			matches++
+		}
+		if e.Type == model.GrepEventDone {
+			break
+		}
+	}
+	if matches != 2 {
+		t.Errorf("expected 2 matches, got %v", matches)
+	}
+}
+
+func TestWSTailSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	app, web := filepath.Join(dir, "app.log"), filepath.Join(dir, "web.log")
+	for _, log := range []string{app, web} {
+		if err = ioutil.WriteFile(log, []byte("start\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/lv/"+model.TailLogStreamEndpoint {
+			h.TailLogStream(w, r)
+		}
+	}))
+	defer remote.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.TailSessionWS(w, r)
+	}))
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	send := func(m model.TailMessage) {
+		if err := ws.WriteJSON(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() *model.TailFrame {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var f model.TailFrame
+		if err := ws.ReadJSON(&f); err != nil {
+			t.Fatal(err)
+		}
+		return &f
+	}
+	//frames of subscriptions arrive in any order
+	expect := func(n int) map[string]*model.TailFrame {
+		frames := make(map[string]*model.TailFrame)
+		for i := 0; i < n; i++ {
+			f := read()
+			if f.Type == model.TailFrameLines && frames["subscribed "+f.ID] == nil && frames["resumed "+f.ID] == nil {
+				t.Fatalf("expected acknowledgement before lines of %v", f.ID)
+			}
+			frames[f.Type+" "+f.ID] = f
+		}
+		return frames
+	}
+	appendLine := func(log string, line string) {
+		f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(line + "\n")
+		f.Close()
+	}
+	send(model.TailMessage{Type: model.TailSubscribe, ID: "app", Request: &model.LogRequest{Log: app}})
+	send(model.TailMessage{Type: model.TailSubscribe, ID: "web", Host: remote.URL, Request: &model.LogRequest{Log: web}})
+	frames := expect(4)
+	for _, id := range []string{"app", "web"} {
+		if frames["subscribed "+id] == nil || frames["tail "+id] == nil || frames["tail "+id].Tail.Lines[0] != "start" {
+			t.Fatalf("expected subscription and tail of %v, got %v", id, frames)
+		}
+	}
+	if f := frames["tail web"]; f.Host != remote.URL || f.Log != web || f.Tail.Host != remote.URL {
+		t.Fatalf("expected frame tagged with remote host, got %+v", f)
+	}
+
+	send(model.TailMessage{Type: model.TailPause, ID: "app"})
+	if f := read(); f.Type != model.TailFramePaused {
+		t.Fatalf("expected pause ack, got %+v", f)
+	}
+	appendLine(app, "app paused")
+	appendLine(web, "web line")
+	if f := read(); f.ID != "web" || f.Tail.Lines[0] != "web line" {
+		t.Fatalf("expected only line of web, got %+v", f)
+	}
+	send(model.TailMessage{Type: model.TailResume, ID: "app"})
+	frames = expect(2)
+	if frames["resumed app"] == nil || frames["tail app"] == nil || frames["tail app"].Tail.Lines[0] != "app paused" {
+		t.Fatalf("expected line written while paused after resume, got %v", frames)
+	}
+
+	send(model.TailMessage{Type: model.TailUnsubscribe, ID: "web"})
+	if f := read(); f.Type != model.TailFrameUnsubscribed {
+		t.Fatalf("expected unsubscribe ack, got %+v", f)
+	}
+	send(model.TailMessage{Type: "bogus", ID: "app"})
+	if f := read(); f.Type != model.TailFrameError {
+		t.Fatalf("expected error for unknown message, got %+v", f)
+	}
+}
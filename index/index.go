@@ -0,0 +1,499 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+	"github.com/RomanLorens/logviewer-module/search"
+	"github.com/RomanLorens/logviewer-module/utils"
+)
+
+//headSize bytes from file start identifying file, rotated or truncated file has different head
+const headSize = 256
+
+//version of index format, indexes of other versions are rebuilt
+const version = 2
+
+//segmentPositions positions of update written to segment at once, large files are indexed into
+//several segments
+var segmentPositions = 1 << 20
+
+//maxSegments segments of file merged into one when exceeded
+var maxSegments = 8
+
+//Indexer maintains on-disk inverted indexes of reqid and user fields, optionally of all tokens,
+//mapping lower cased values to record positions, files are indexed incrementally as they grow
+//and rebuilt when rotated or truncated, postings of each update are appended as segment and
+//read per term on lookup
+type Indexer struct {
+	dir    string
+	tokens bool
+	logger l.Logger
+	//update serializes updates, mu guards maps and indexes
+	update sync.Mutex
+	mu     sync.RWMutex
+	logs   map[string]*model.LogStructure
+	files  map[string]*fileIndex
+	states map[string]*model.IndexStatus
+}
+
+//fileIndex index of single file, End is position of first not indexed record
+type fileIndex struct {
+	Version int
+	Path    string
+	Head    []byte
+	Size    int64
+	End     search.Position
+	Tokens  bool
+	//Segments segment files in index dir, oldest first
+	Segments []string
+	//Terms terms of segments, term of several segments is counted in each
+	Terms    int
+	segments []*segment
+}
+
+//NewIndexer new indexer storing indexes in dir, tokens indexes every token of record first line
+func NewIndexer(dir string, tokens bool, logger l.Logger) *Indexer {
+	return &Indexer{dir: dir, tokens: tokens, logger: logger, logs: make(map[string]*model.LogStructure),
+		files: make(map[string]*fileIndex), states: make(map[string]*model.IndexStatus)}
+}
+
+//Add registers log to be kept indexed by UpdateAll
+func (ix *Indexer) Add(log string, ls *model.LogStructure) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.logs[log] = ls
+}
+
+//UpdateAll updates indexes of all registered logs, to be run by scheduler
+func (ix *Indexer) UpdateAll(ctx context.Context) {
+	ix.mu.RLock()
+	logs := make(map[string]*model.LogStructure, len(ix.logs))
+	for k, v := range ix.logs {
+		logs[k] = v
+	}
+	ix.mu.RUnlock()
+	for log, ls := range logs {
+		if _, err := ix.Update(log, ls); err != nil {
+			ix.logger.Error(ctx, "Could not index %v, %v", log, err)
+		}
+	}
+	ix.prune(ctx)
+}
+
+//Start registers log to be kept indexed by UpdateAll and indexes it in background unless it is
+//being indexed already, returns status of log
+func (ix *Indexer) Start(ctx context.Context, log string, ls *model.LogStructure) (*model.IndexStatus, error) {
+	if ls == nil {
+		return nil, fmt.Errorf("Indexing %v requires log structure", log)
+	}
+	ix.Add(log, ls)
+	status, running := ix.begin(log)
+	if running {
+		return status, nil
+	}
+	go func() {
+		defer utils.CatchError(ctx, ix.logger)
+		if _, err := ix.Update(log, ls); err != nil {
+			ix.logger.Error(ctx, "Could not index %v, %v", log, err)
+		}
+	}()
+	return status, nil
+}
+
+//Status status of last or running update of log
+func (ix *Indexer) Status(log string) (*model.IndexStatus, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	status, ok := ix.states[log]
+	if !ok {
+		return nil, fmt.Errorf("Log %v is not indexed", log)
+	}
+	return copyStatus(status), nil
+}
+
+//begin marks log as being indexed keeping files of last status, true when it was marked already
+func (ix *Indexer) begin(log string) (*model.IndexStatus, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	status, ok := ix.states[log]
+	if ok && status.State == model.IndexIndexing {
+		return copyStatus(status), true
+	}
+	running := &model.IndexStatus{Log: log, State: model.IndexIndexing, Files: []model.IndexedFile{}}
+	if ok {
+		running.Files = status.Files
+	}
+	ix.states[log] = running
+	return copyStatus(running), false
+}
+
+func copyStatus(s *model.IndexStatus) *model.IndexStatus {
+	c := *s
+	c.Files = append([]model.IndexedFile{}, s.Files...)
+	return &c
+}
+
+//Update indexes new records of log and its rotations
+func (ix *Indexer) Update(log string, ls *model.LogStructure) (*model.IndexStatus, error) {
+	if ls == nil {
+		return nil, fmt.Errorf("Indexing %v requires log structure", log)
+	}
+	ix.begin(log)
+	ix.update.Lock()
+	status, err := ix.updateLog(log, ls)
+	ix.update.Unlock()
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if err != nil {
+		failed := copyStatus(ix.states[log])
+		failed.State, failed.Error = model.IndexFailed, err.Error()
+		ix.states[log] = failed
+		return nil, err
+	}
+	ix.states[log] = status
+	return copyStatus(status), nil
+}
+
+func (ix *Indexer) updateLog(log string, ls *model.LogStructure) (*model.IndexStatus, error) {
+	files, err := search.RotationChain(log)
+	if err != nil {
+		return nil, err
+	}
+	status := &model.IndexStatus{Log: log, State: model.IndexReady, Files: make([]model.IndexedFile, 0, len(files))}
+	for _, f := range files {
+		fi, err := ix.updateFile(f, ls)
+		if err != nil {
+			return nil, fmt.Errorf("Could not index %v, %v", f, err)
+		}
+		ix.mu.RLock()
+		status.Files = append(status.Files, fi.status())
+		ix.mu.RUnlock()
+	}
+	return status, nil
+}
+
+//Lookup implements search.Index
+func (ix *Indexer) Lookup(file string, field string, value string) ([]search.Position, search.Position, bool) {
+	fi := ix.get(file)
+	if fi == nil {
+		return nil, search.Position{}, false
+	}
+	head, size, err := readHead(file)
+	if err != nil {
+		return nil, search.Position{}, false
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if !fi.current(head, size) || (field == model.FieldToken && !fi.Tokens) {
+		return nil, search.Position{}, false
+	}
+	positions := make([]search.Position, 0)
+	for _, s := range fi.segments {
+		p, err := s.lookup(field, value)
+		if err != nil {
+			ix.logger.Error(context.Background(), "Could not look up %v in index of %v, %v", value, file, err)
+			return nil, search.Position{}, false
+		}
+		positions = append(positions, p...)
+	}
+	return positions, fi.End, true
+}
+
+func (ix *Indexer) updateFile(path string, ls *model.LogStructure) (*fileIndex, error) {
+	head, size, err := readHead(path)
+	if err != nil {
+		return nil, err
+	}
+	fi := ix.get(path)
+	ix.mu.Lock()
+	if fi != nil && fi.current(head, size) && fi.Tokens == ix.tokens {
+		if fi.Size == size {
+			ix.mu.Unlock()
+			return fi, nil
+		}
+	} else {
+		if fi != nil {
+			ix.removeSegments(fi.Segments)
+		}
+		fi = &fileIndex{Version: version, Path: path, Tokens: ix.tokens, End: search.Position{LineNumber: 1}}
+		ix.files[path] = fi
+	}
+	fi.Head = head
+	ix.mu.Unlock()
+	if err := os.MkdirAll(ix.dir, 0755); err != nil {
+		return nil, fmt.Errorf("Could not create index dir %v, %v", ix.dir, err)
+	}
+	err = ix.scan(path, ls, fi.End, func(postings map[string]map[string][]search.Position, end search.Position) error {
+		return ix.flush(fi, postings, end)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ix.mu.Lock()
+	fi.Size = size
+	ix.mu.Unlock()
+	if err = ix.save(fi); err != nil {
+		return nil, err
+	}
+	if len(fi.Segments) > maxSegments {
+		if err = ix.compact(fi); err != nil {
+			return nil, err
+		}
+	}
+	return fi, nil
+}
+
+//flush writes postings as new segment and saves index of file up to end
+func (ix *Indexer) flush(fi *fileIndex, postings map[string]map[string][]search.Position, end search.Position) error {
+	var name string
+	terms := 0
+	for _, values := range postings {
+		terms += len(values)
+	}
+	if terms > 0 {
+		path, n, err := writeSegment(ix.dir, ix.name(fi.Path), postings)
+		if err != nil {
+			return err
+		}
+		name, terms = path, n
+	}
+	ix.mu.Lock()
+	if name != "" {
+		fi.Segments = append(fi.Segments, filepath.Base(name))
+		fi.segments = append(fi.segments, &segment{path: name})
+		fi.Terms += terms
+	}
+	fi.End = end
+	ix.mu.Unlock()
+	return ix.save(fi)
+}
+
+//compact merges segments of file into one
+func (ix *Indexer) compact(fi *fileIndex) error {
+	name, terms, err := mergeSegments(ix.dir, ix.name(fi.Path), fi.segments)
+	if err != nil {
+		return fmt.Errorf("Could not merge index segments of %v, %v", fi.Path, err)
+	}
+	ix.mu.Lock()
+	merged := fi.Segments
+	fi.Segments, fi.segments, fi.Terms = []string{filepath.Base(name)}, []*segment{{path: name}}, terms
+	ix.mu.Unlock()
+	if err = ix.save(fi); err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	ix.removeSegments(merged)
+	ix.mu.Unlock()
+	return nil
+}
+
+//removeSegments removes segment files, mu must be held so no lookup reads them
+func (ix *Indexer) removeSegments(names []string) {
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(ix.dir, name)); err != nil && !os.IsNotExist(err) {
+			ix.logger.Error(context.Background(), "Could not remove index segment %v, %v", name, err)
+		}
+	}
+}
+
+//scan indexes records from position, postings are flushed every segmentPositions positions and at
+//the end, last record is left for next update as it may still grow
+func (ix *Indexer) scan(path string, ls *model.LogStructure, from search.Position, flush func(map[string]map[string][]search.Position, search.Position) error) error {
+	scanner, f, err := search.OpenRecordsAt(path, ls, from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fields := []string{model.FieldReqID, model.FieldUser}
+	if ix.tokens {
+		fields = append(fields, model.FieldToken)
+	}
+	p, err := parser.Of(ls)
+	if err != nil {
+		return err
+	}
+	out := newPostings(fields)
+	var last *search.Record
+	end := from
+	count := 0
+	for scanner.Scan() {
+		if last != nil {
+			count += add(out, fields, last, p, end)
+		}
+		rec := *scanner.Record()
+		last = &rec
+		end = search.Position{Offset: rec.Offset, LineNumber: rec.LineNumber}
+		if count >= segmentPositions {
+			if err = flush(out, end); err != nil {
+				return err
+			}
+			out, count = newPostings(fields), 0
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return flush(out, end)
+}
+
+func newPostings(fields []string) map[string]map[string][]search.Position {
+	out := make(map[string]map[string][]search.Position, len(fields))
+	for _, field := range fields {
+		out[field] = make(map[string][]search.Position)
+	}
+	return out
+}
+
+//add adds positions of record values, returns number of positions added
+func add(out map[string]map[string][]search.Position, fields []string, rec *search.Record, rp parser.Parser, p search.Position) int {
+	line := rec.FirstLine()
+	added := 0
+	for _, field := range fields {
+		for _, v := range search.FieldValues(line, field, rp) {
+			v = strings.ToLower(v)
+			positions := out[field][v]
+			if n := len(positions); n > 0 && positions[n-1] == p {
+				continue
+			}
+			out[field][v] = append(positions, p)
+			added++
+		}
+	}
+	return added
+}
+
+//current true when file still starts with indexed head and did not shrink
+func (fi *fileIndex) current(head []byte, size int64) bool {
+	return size >= fi.Size && bytes.HasPrefix(head, fi.Head)
+}
+
+func (fi *fileIndex) status() model.IndexedFile {
+	return model.IndexedFile{File: fi.Path, Indexed: fi.End.Offset, Size: fi.Size, Terms: fi.Terms,
+		Segments: len(fi.Segments), Tokens: fi.Tokens}
+}
+
+//get cached index of file, loaded from disk on first access
+func (ix *Indexer) get(path string) *fileIndex {
+	ix.mu.RLock()
+	fi, ok := ix.files[path]
+	ix.mu.RUnlock()
+	if ok {
+		return fi
+	}
+	fi, err := ix.load(path)
+	if err != nil {
+		return nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if cached, ok := ix.files[path]; ok {
+		return cached
+	}
+	ix.files[path] = fi
+	return fi
+}
+
+func (ix *Indexer) load(path string) (*fileIndex, error) {
+	f, err := os.Open(ix.indexFile(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var fi fileIndex
+	if err = gob.NewDecoder(f).Decode(&fi); err != nil {
+		return nil, fmt.Errorf("Could not decode index of %v, %v", path, err)
+	}
+	if fi.Version != version {
+		return nil, fmt.Errorf("Index %v has version %v", ix.indexFile(path), fi.Version)
+	}
+	if fi.Path != path {
+		return nil, fmt.Errorf("Index %v belongs to %v", ix.indexFile(path), fi.Path)
+	}
+	for _, name := range fi.Segments {
+		fi.segments = append(fi.segments, &segment{path: filepath.Join(ix.dir, name)})
+	}
+	return &fi, nil
+}
+
+//save writes index without postings to temp file renamed over previous one
+func (ix *Indexer) save(fi *fileIndex) error {
+	tmp, err := ioutil.TempFile(ix.dir, "idx")
+	if err != nil {
+		return fmt.Errorf("Could not create index file, %v", err)
+	}
+	ix.mu.RLock()
+	err = gob.NewEncoder(tmp).Encode(fi)
+	ix.mu.RUnlock()
+	if er := tmp.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not write index of %v, %v", fi.Path, err)
+	}
+	return os.Rename(tmp.Name(), ix.indexFile(fi.Path))
+}
+
+//prune drops indexes of deleted files
+func (ix *Indexer) prune(ctx context.Context) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for path, fi := range ix.files {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		delete(ix.files, path)
+		ix.removeSegments(fi.Segments)
+		if err := os.Remove(ix.indexFile(path)); err != nil && !os.IsNotExist(err) {
+			ix.logger.Error(ctx, "Could not remove index of %v, %v", path, err)
+		}
+	}
+}
+
+func (ix *Indexer) indexFile(path string) string {
+	return filepath.Join(ix.dir, ix.name(path)+".idx")
+}
+
+//name of index files of path
+func (ix *Indexer) name(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha1.Sum([]byte(path))
+	return hex.EncodeToString(sum[:])
+}
+
+//readHead first bytes and size of file
+func readHead(path string) ([]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	head := make([]byte, headSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, 0, err
+	}
+	return head[:n], info.Size(), nil
+}
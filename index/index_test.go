@@ -0,0 +1,233 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/search"
+)
+
+var ls = &model.LogStructure{Date: 0, User: 4, Reqid: 5, Level: 2, Message: 6, DateFormat: "2006-01-02 15:04:05"}
+
+func record(i int, reqid string) string {
+	return fmt.Sprintf("2021-05-06 11:27:%02d|main|INFO|Service|user%v|%v|processing %v\n", i%60, i%3, reqid, i)
+}
+
+func grep(t *testing.T, path string, reqid string) []model.GrepMatch {
+	res, err := search.Grep(context.Background(), &model.GrepRequest{Value: reqid, Field: model.FieldReqID,
+		Logs: []string{path}, LogStructure: ls}, log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Error != "" {
+		t.Fatal(res[0].Error)
+	}
+	return res[0].Lines
+}
+
+func TestIndexLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		f.WriteString(record(i, fmt.Sprintf("1-01-CV-%v@host#6", i%10)))
+	}
+
+	scanned := grep(t, path, "1-01-cv-3@host#6")
+	ix := NewIndexer(filepath.Join(dir, "idx"), false, log.PrintLogger(false))
+	search.UseIndex(ix)
+	defer search.UseIndex(nil)
+	status, err := ix.Update(path, ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Files) != 1 || status.Files[0].Terms == 0 {
+		t.Fatalf("expected indexed file, got %+v", status)
+	}
+	if _, _, ok := ix.Lookup(path, model.FieldReqID, "1-01-cv-3@host#6"); !ok {
+		t.Fatal("expected log to be indexed")
+	}
+	if _, _, ok := ix.Lookup(path, model.FieldToken, "processing"); ok {
+		t.Fatal("tokens are not indexed")
+	}
+	indexed := grep(t, path, "1-01-cv-3@host#6")
+	if len(indexed) != 10 || !reflect.DeepEqual(indexed, scanned) {
+		t.Fatalf("expected indexed results equal to scan, got %v, expected %v", indexed, scanned)
+	}
+
+	//time range without date format fails like scan of unindexed log
+	noDate := *ls
+	noDate.DateFormat = ""
+	rangeErr := func() string {
+		res, err := search.Grep(context.Background(), &model.GrepRequest{Value: "1-01-cv-3@host#6", Field: model.FieldReqID,
+			Logs: []string{path}, LogStructure: &noDate, FromTime: 1}, log.PrintLogger(false))
+		if err != nil {
+			return err.Error()
+		}
+		return res[0].Error
+	}
+	indexedErr := rangeErr()
+	search.UseIndex(nil)
+	scannedErr := rangeErr()
+	search.UseIndex(ix)
+	if indexedErr == "" || indexedErr != scannedErr {
+		t.Fatalf("expected same time range error with and without index, got '%v' and '%v'", indexedErr, scannedErr)
+	}
+
+	//records appended after update are scanned
+	f.WriteString(record(100, "1-01-CV-3@host#6"))
+	f.Close()
+	if got := grep(t, path, "1-01-CV-3@host#6"); len(got) != 11 || got[10].LineNumber != 101 {
+		t.Fatalf("expected appended record, got %v", got)
+	}
+
+	//loaded from disk by new indexer
+	ix = NewIndexer(filepath.Join(dir, "idx"), false, log.PrintLogger(false))
+	search.UseIndex(ix)
+	if positions, _, ok := ix.Lookup(path, model.FieldReqID, "1-01-cv-3@host#6"); !ok || len(positions) != 10 {
+		t.Fatalf("expected index loaded from disk, got %v", positions)
+	}
+
+	//rotated file is not answered from stale index
+	if err = ioutil.WriteFile(path, []byte(record(1, "1-01-CV-7@host#6")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := ix.Lookup(path, model.FieldReqID, "1-01-cv-3@host#6"); ok {
+		t.Fatal("expected stale index after rotation")
+	}
+	if got := grep(t, path, "1-01-CV-7@host#6"); len(got) != 1 {
+		t.Fatalf("expected match in rotated log, got %v", got)
+	}
+	if _, err = ix.Update(path, ls); err != nil {
+		t.Fatal(err)
+	}
+	if positions, _, ok := ix.Lookup(path, model.FieldReqID, "1-01-cv-3@host#6"); !ok || len(positions) != 0 {
+		t.Fatalf("expected rebuilt index, got %v", positions)
+	}
+}
+
+func TestIndexSegments(t *testing.T) {
+	defer func(positions, segments int) { segmentPositions, maxSegments = positions, segments }(segmentPositions, maxSegments)
+	segmentPositions, maxSegments = 5, 3
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 100; i++ {
+		f.WriteString(record(i, fmt.Sprintf("1-01-CV-%v@host#6", i%10)))
+	}
+	idx := filepath.Join(dir, "idx")
+	segments := func() int {
+		files, _ := filepath.Glob(filepath.Join(idx, "*.seg"))
+		return len(files)
+	}
+	ix := NewIndexer(idx, false, log.PrintLogger(false))
+	status, err := ix.Update(path, ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Files[0].Segments != 1 || segments() != 1 {
+		t.Fatalf("expected segments merged into one, got %+v and %v files", status.Files[0], segments())
+	}
+	positions, _, ok := ix.Lookup(path, model.FieldReqID, "1-01-cv-3@host#6")
+	if !ok || len(positions) != 10 || positions[0].LineNumber != 4 || positions[9].LineNumber != 94 {
+		t.Fatalf("expected positions of merged segments, got %v", positions)
+	}
+
+	//appended records are written to new segment
+	for i := 100; i < 103; i++ {
+		f.WriteString(record(i, "1-01-CV-3@host#6"))
+	}
+	if status, err = ix.Update(path, ls); err != nil {
+		t.Fatal(err)
+	}
+	if status.Files[0].Segments != 2 || segments() != 2 {
+		t.Fatalf("expected appended segment, got %+v and %v files", status.Files[0], segments())
+	}
+	ix = NewIndexer(idx, false, log.PrintLogger(false))
+	if positions, _, ok = ix.Lookup(path, model.FieldReqID, "1-01-cv-3@host#6"); !ok || len(positions) != 12 {
+		t.Fatalf("expected positions read from segments on disk, got %v", positions)
+	}
+
+	//rebuilt index removes segments of rotated file
+	if err = ioutil.WriteFile(path, []byte(record(1, "1-01-CV-7@host#6")+record(2, "1-01-CV-7@host#6")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ix.Update(path, ls); err != nil {
+		t.Fatal(err)
+	}
+	if n := segments(); n != 1 {
+		t.Fatalf("expected segment of rebuilt index only, got %v", n)
+	}
+}
+
+func TestIndexStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(path, []byte(record(1, "1-01-CV-1@host#6")+record(2, "1-01-CV-2@host#6")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndexer(filepath.Join(dir, "idx"), false, log.PrintLogger(false))
+	if _, err = ix.Status(path); err == nil {
+		t.Fatal("expected log not to be indexed yet")
+	}
+	wait := func(log string) *model.IndexStatus {
+		for i := 0; i < 100; i++ {
+			status, err := ix.Status(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.State != model.IndexIndexing {
+				return status
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected indexing of %v to finish", log)
+		return nil
+	}
+
+	status, err := ix.Start(context.Background(), path, ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != model.IndexIndexing {
+		t.Fatalf("expected log to be indexed in background, got %+v", status)
+	}
+	if status = wait(path); status.State != model.IndexReady || len(status.Files) != 1 || status.Files[0].Indexed == 0 {
+		t.Fatalf("expected indexed log, got %+v", status)
+	}
+
+	missing := filepath.Join(dir, "missing.log")
+	if _, err = ix.Start(context.Background(), missing, ls); err != nil {
+		t.Fatal(err)
+	}
+	if status = wait(missing); status.State != model.IndexFailed || status.Error == "" {
+		t.Fatalf("expected failed indexing, got %+v", status)
+	}
+}
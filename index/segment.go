@@ -0,0 +1,240 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/RomanLorens/logviewer-module/search"
+)
+
+//trailerSize bytes of dictionary offset at end of segment file
+const trailerSize = 8
+
+//segment postings written by one update, positions of term are varint encoded at extent of term,
+//dictionary of extents follows postings and is loaded on first lookup
+type segment struct {
+	path string
+	mu   sync.Mutex
+	dict map[string]map[string]extent
+}
+
+//extent postings of term in segment file
+type extent struct {
+	Offset int64
+	Length int
+	Count  int
+}
+
+//segmentWriter writes postings term by term followed by dictionary
+type segmentWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	offset int64
+	dict   map[string]map[string]extent
+	terms  int
+	buf    []byte
+}
+
+func newSegmentWriter(dir string, prefix string) (*segmentWriter, error) {
+	f, err := ioutil.TempFile(dir, prefix+"-*.seg")
+	if err != nil {
+		return nil, fmt.Errorf("Could not create index segment, %v", err)
+	}
+	return &segmentWriter{f: f, w: bufio.NewWriter(f), dict: make(map[string]map[string]extent)}, nil
+}
+
+//add writes ascending positions of term, offsets and line numbers are delta encoded
+func (sw *segmentWriter) add(field string, term string, positions []search.Position) error {
+	sw.buf = sw.buf[:0]
+	var prev search.Position
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, p := range positions {
+		sw.buf = append(sw.buf, tmp[:binary.PutVarint(tmp, p.Offset-prev.Offset)]...)
+		sw.buf = append(sw.buf, tmp[:binary.PutVarint(tmp, int64(p.LineNumber-prev.LineNumber))]...)
+		prev = p
+	}
+	if _, err := sw.w.Write(sw.buf); err != nil {
+		return err
+	}
+	terms, ok := sw.dict[field]
+	if !ok {
+		terms = make(map[string]extent)
+		sw.dict[field] = terms
+	}
+	terms[term] = extent{Offset: sw.offset, Length: len(sw.buf), Count: len(positions)}
+	sw.offset += int64(len(sw.buf))
+	sw.terms++
+	return nil
+}
+
+//close writes dictionary and trailer with its offset, returns name of segment file
+func (sw *segmentWriter) close() (string, error) {
+	err := gob.NewEncoder(sw.w).Encode(sw.dict)
+	if err == nil {
+		var trailer [trailerSize]byte
+		binary.BigEndian.PutUint64(trailer[:], uint64(sw.offset))
+		_, err = sw.w.Write(trailer[:])
+	}
+	if err == nil {
+		err = sw.w.Flush()
+	}
+	if er := sw.f.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		sw.abort()
+		return "", fmt.Errorf("Could not write index segment, %v", err)
+	}
+	return sw.f.Name(), nil
+}
+
+func (sw *segmentWriter) abort() {
+	sw.f.Close()
+	os.Remove(sw.f.Name())
+}
+
+//writeSegment writes postings of update to new segment file
+func writeSegment(dir string, prefix string, postings map[string]map[string][]search.Position) (string, int, error) {
+	sw, err := newSegmentWriter(dir, prefix)
+	if err != nil {
+		return "", 0, err
+	}
+	for field, terms := range postings {
+		for term, positions := range terms {
+			if err := sw.add(field, term, positions); err != nil {
+				sw.abort()
+				return "", 0, fmt.Errorf("Could not write index segment, %v", err)
+			}
+		}
+	}
+	name, err := sw.close()
+	return name, sw.terms, err
+}
+
+//mergeSegments writes postings of segments into single segment term by term, segments are
+//ordered by position so postings of term are concatenated
+func mergeSegments(dir string, prefix string, segments []*segment) (string, int, error) {
+	fields := make(map[string]map[string]bool)
+	for _, s := range segments {
+		dict, err := s.dictionary()
+		if err != nil {
+			return "", 0, err
+		}
+		for field, terms := range dict {
+			if _, ok := fields[field]; !ok {
+				fields[field] = make(map[string]bool)
+			}
+			for term := range terms {
+				fields[field][term] = true
+			}
+		}
+	}
+	sw, err := newSegmentWriter(dir, prefix)
+	if err != nil {
+		return "", 0, err
+	}
+	for field, terms := range fields {
+		sorted := make([]string, 0, len(terms))
+		for term := range terms {
+			sorted = append(sorted, term)
+		}
+		sort.Strings(sorted)
+		for _, term := range sorted {
+			var positions []search.Position
+			for _, s := range segments {
+				p, err := s.lookup(field, term)
+				if err != nil {
+					sw.abort()
+					return "", 0, err
+				}
+				positions = append(positions, p...)
+			}
+			if err := sw.add(field, term, positions); err != nil {
+				sw.abort()
+				return "", 0, fmt.Errorf("Could not write index segment, %v", err)
+			}
+		}
+	}
+	name, err := sw.close()
+	return name, sw.terms, err
+}
+
+//dictionary extents of terms, read from segment file on first access
+func (s *segment) dictionary() (map[string]map[string]extent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dict != nil {
+		return s.dict, nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var trailer [trailerSize]byte
+	if info.Size() < trailerSize {
+		return nil, fmt.Errorf("Index segment %v is truncated", s.path)
+	}
+	if _, err = f.ReadAt(trailer[:], info.Size()-trailerSize); err != nil {
+		return nil, err
+	}
+	offset := int64(binary.BigEndian.Uint64(trailer[:]))
+	if offset > info.Size()-trailerSize {
+		return nil, fmt.Errorf("Index segment %v is corrupted", s.path)
+	}
+	var dict map[string]map[string]extent
+	r := io.NewSectionReader(f, offset, info.Size()-trailerSize-offset)
+	if err = gob.NewDecoder(r).Decode(&dict); err != nil {
+		return nil, fmt.Errorf("Could not decode index segment %v, %v", s.path, err)
+	}
+	s.dict = dict
+	return dict, nil
+}
+
+//lookup reads positions of term from segment file
+func (s *segment) lookup(field string, term string) ([]search.Position, error) {
+	dict, err := s.dictionary()
+	if err != nil {
+		return nil, err
+	}
+	e, ok := dict[field][term]
+	if !ok {
+		return nil, nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, e.Length)
+	if _, err = f.ReadAt(b, e.Offset); err != nil {
+		return nil, fmt.Errorf("Could not read index segment %v, %v", s.path, err)
+	}
+	positions := make([]search.Position, 0, e.Count)
+	var p search.Position
+	for len(b) > 0 {
+		offset, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("Index segment %v is corrupted", s.path)
+		}
+		line, m := binary.Varint(b[n:])
+		if m <= 0 {
+			return nil, fmt.Errorf("Index segment %v is corrupted", s.path)
+		}
+		b = b[n+m:]
+		p = search.Position{Offset: p.Offset + offset, LineNumber: p.LineNumber + int(line)}
+		positions = append(positions, p)
+	}
+	return positions, nil
+}
@@ -1,27 +1,79 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/alert"
 	h "github.com/RomanLorens/logviewer-module/handler"
+	"github.com/RomanLorens/logviewer-module/index"
 	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/profile"
+	"github.com/RomanLorens/logviewer-module/scheduler"
+	"github.com/RomanLorens/logviewer-module/search"
 )
 
+//alertRules json file with alert rules
+const alertRules = "alerts.json"
+
+//profiles json file with log structure profiles
+const profiles = "profiles.json"
+
 func main() {
 
 	http.HandleFunc("/", root)
-	handler := h.NewHandler(l.PrintLogger(false))
+	logger := l.PrintLogger(false)
+	handler := h.NewHandler(logger)
+	indexer := index.NewIndexer("lv-index", false, logger)
+	search.UseIndex(indexer)
+	handler.SetIndexer(indexer)
+	s := scheduler.NewScheduler(logger)
+	s.Schedule(context.Background(), &scheduler.Task{Name: "log indexer", Run: indexer.UpdateAll}, time.Minute)
+	registry := profile.NewRegistry()
+	if err := registry.Load(profiles); err != nil {
+		log.Fatal(err)
+	}
+	handler.SetProfiles(registry)
+	alerter := alert.NewAlerter(logger)
+	if _, err := os.Stat(alertRules); err == nil {
+		rules, err := alert.LoadRules(alertRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, r := range rules {
+			if err := registry.Resolve(r.Profile, &r.LogStructure); err != nil {
+				log.Fatal(err)
+			}
+			if err := alerter.AddRule(r); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	handler.SetAlerter(alerter)
+	s.Schedule(context.Background(), &scheduler.Task{Name: "alerts", Run: alerter.Run}, 10*time.Second)
 	register("/lv/"+model.SearchEndpoint, handler.Search)
+	register("/lv/"+model.SearchStreamEndpoint, handler.SearchStream)
 	register("/lv/"+model.ListLogsEndpoint, handler.ListLogs)
 	register("/lv/"+model.StatsEndpoint, handler.Stats)
 	register("/lv/"+model.ErrorsEndpoint, handler.Errors)
+	register("/lv/"+model.ErrorGroupsEndpoint, handler.ErrorGroups)
+	register("/lv/"+model.HistogramEndpoint, handler.Histogram)
 	register("/lv/"+model.DownloadLogEndpoint, handler.DownloadLog)
 	register("/lv/"+model.CollectStatsEndpoint, handler.CollectStats)
 	register("/lv/"+model.TailLogEndpoint, handler.TailLog)
+	register("/lv/"+model.TailLogStreamEndpoint, handler.TailLogStream)
+	register("/lv/"+model.IndexEndpoint, handler.Index)
+	register("/lv/"+model.TraceEndpoint, handler.Trace)
+	register("/lv/"+model.ReadEndpoint, handler.Read)
+	register("/lv/"+model.DetectStructureEndpoint, handler.DetectStructure)
+	register("/lv/"+model.AlertsEndpoint, handler.Alerts)
+	register("/lv/"+model.ProfilesEndpoint, handler.Profiles)
 
 	register("/lv/support/memory", handler.MemoryDiagnostics)
 	register("/lv/support/health", handler.HealthHandler)
@@ -2,16 +2,76 @@ package model
 
 //GrepRequest req
 type GrepRequest struct {
-	Value string   `json:"value"`
-	Logs  []string `json:"logs"`
+	Value         string        `json:"value"`
+	Logs          []string      `json:"logs"`
+	Mode          string        `json:"mode"`
+	CaseSensitive bool          `json:"caseSensitive"`
+	Before        int           `json:"before"`
+	After         int           `json:"after"`
+	LogStructure  *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+	//FromTime and ToTime epoch millis, [from, to) window, 0 is open bound
+	FromTime int64 `json:"fromTime"`
+	ToTime   int64 `json:"toTime"`
+	//History searches the whole rotation chain of the log
+	History bool `json:"history"`
+	//MaxResults max matches per log, 0 is unlimited
+	MaxResults int `json:"maxResults"`
+	//Cursors from previous responses, grep resumes where it stopped
+	Cursors []string `json:"cursors"`
+	//Reverse reads logs backwards, newest match first
+	Reverse bool `json:"reverse"`
+	//Field exact lookup, Value must equal whole reqid, user or token of record,
+	//indexed logs are answered from index
+	Field string `json:"field"`
+}
+
+//GrepLine line with its number, File is set for lines from rotated files
+type GrepLine struct {
+	LineNumber int    `json:"lineNumber"`
+	Offset     int64  `json:"offset"`
+	Line       string `json:"line"`
+	File       string `json:"file,omitempty"`
+}
+
+//Highlight match in line, Start and End are rune offsets, ByteStart and ByteEnd byte offsets, end is exclusive
+type Highlight struct {
+	Start     int `json:"start"`
+	End       int `json:"end"`
+	ByteStart int `json:"byteStart"`
+	ByteEnd   int `json:"byteEnd"`
+}
+
+//GrepMatch matched line with highlights and context lines before and after
+type GrepMatch struct {
+	GrepLine
+	Highlights []Highlight `json:"highlights,omitempty"`
+	Before     []GrepLine  `json:"before,omitempty"`
+	After      []GrepLine  `json:"after,omitempty"`
 }
 
 //GrepResponse search result
 type GrepResponse struct {
-	LogFile string   `json:"logfile"`
-	Lines   []string `json:"lines"`
-	Host    string   `json:"host"`
-	Time    int64    `json:"time"`
+	LogFile string      `json:"logfile"`
+	Lines   []GrepMatch `json:"lines"`
+	Host    string      `json:"host"`
+	Time    int64       `json:"time"`
+	//Cursor set when grep stopped at max results, pass it back to get next page
+	Cursor string `json:"cursor,omitempty"`
+	//Error why log could not be searched
+	Error string `json:"error,omitempty"`
+}
+
+//GrepEvent streamed search event
+type GrepEvent struct {
+	Type    string     `json:"type"`
+	LogFile string     `json:"logfile,omitempty"`
+	Match   *GrepMatch `json:"match,omitempty"`
+	Scanned int64      `json:"scanned,omitempty"`
+	Total   int64      `json:"total,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	Cursor  string     `json:"cursor,omitempty"`
 }
 
 //ListLogsRequest list logs
@@ -22,6 +82,30 @@ type ListLogsRequest struct {
 //LogRequest log req
 type LogRequest struct {
 	Log string `json:"log"`
+	//History reads previous rotations when the log itself is too short
+	History bool `json:"history"`
+	//Filter returns only matching lines with highlights
+	Filter *TailFilter `json:"filter"`
+	//Lines number of complete records to tail, default is last kilobytes of log
+	Lines int `json:"lines"`
+	//MaxBytes max bytes to tail
+	MaxBytes int64 `json:"maxBytes"`
+	//LogStructure groups multi-line records when tailing Lines
+	LogStructure *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+}
+
+//TailFilter tail filter query
+type TailFilter struct {
+	//Value substring or regex, with LogStructure matched against message of record
+	Value         string `json:"value"`
+	Mode          string `json:"mode"`
+	CaseSensitive bool   `json:"caseSensitive"`
+	//Level, User and ReqID equal to fields of record, need LogStructure
+	Level string `json:"level"`
+	User  string `json:"user"`
+	ReqID string `json:"reqid"`
 }
 
 //ReqID req id
@@ -43,6 +127,13 @@ type Stat struct {
 type StatsRequest struct {
 	Log          string        `json:"log"`
 	LogStructure *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+	//FromTime and ToTime epoch millis, [from, to) window, 0 is open bound
+	FromTime int64 `json:"fromTime"`
+	ToTime   int64 `json:"toTime"`
+	//History reads the whole rotation chain of the log
+	History bool `json:"history"`
 }
 
 //ErrorsRequest errors req
@@ -52,6 +143,57 @@ type ErrorsRequest struct {
 	*StatsRequest
 }
 
+//ErrorGroupsRequest error groups req, Size defaults to 20, Sort is count (default), users,
+//firstSeen or lastSeen, all descending
+type ErrorGroupsRequest struct {
+	From int    `json:"from"`
+	Size int    `json:"size"`
+	Sort string `json:"sort"`
+	*StatsRequest
+}
+
+//ErrorGroup errors and warnings with the same fingerprint, Message is normalized message
+//of group, Users are first affected users, UserCount all of them
+type ErrorGroup struct {
+	Fingerprint string `json:"fingerprint"`
+	Level       string `json:"level"`
+	Message     string `json:"message"`
+	//Sample first record of group
+	Sample      string   `json:"sample"`
+	SampleReqID string   `json:"sampleReqid"`
+	Count       int      `json:"count"`
+	Users       []string `json:"users"`
+	UserCount   int      `json:"userCount"`
+	//FirstSeen and LastSeen dates of records, FirstTime and LastTime epoch millis, 0 when
+	//date is not parsable
+	FirstSeen string `json:"firstSeen"`
+	LastSeen  string `json:"lastSeen"`
+	FirstTime int64  `json:"firstTime"`
+	LastTime  int64  `json:"lastTime"`
+	//Trend counts of group in equal parts of [TrendStart, TrendEnd] of response
+	Trend []int `json:"trend"`
+}
+
+//ErrorGroupsPagination error groups with pagination, TrendStart and TrendEnd epoch millis of
+//first and last error
+type ErrorGroupsPagination struct {
+	Groups     []ErrorGroup `json:"groups"`
+	Pagination *Pagination  `json:"pagination"`
+	TrendStart int64        `json:"trendStart"`
+	TrendEnd   int64        `json:"trendEnd"`
+}
+
+const (
+	//ErrorGroupsByCount most frequent groups first
+	ErrorGroupsByCount = "count"
+	//ErrorGroupsByUsers groups affecting most users first
+	ErrorGroupsByUsers = "users"
+	//ErrorGroupsByFirstSeen newest groups first
+	ErrorGroupsByFirstSeen = "firstSeen"
+	//ErrorGroupsByLastSeen recently seen groups first
+	ErrorGroupsByLastSeen = "lastSeen"
+)
+
 //Search search
 type Search struct {
 	Value         string   `json:"value"`
@@ -70,6 +212,15 @@ type TailLogResponse struct {
 	Host    string   `json:"host"`
 	Time    int64    `json:"time"`
 	ModTime int64    `json:"modtime"`
+	//Highlights of filter matches, one entry per line
+	Highlights [][]Highlight `json:"highlights,omitempty"`
+	//Offset in log after last line read
+	Offset int64 `json:"offset"`
+	//Event rotated or truncated when log was replaced since previous response
+	Event string `json:"event,omitempty"`
+	//Records number of records starting in lines, continuation of record from previous
+	//response is not counted
+	Records int `json:"records,omitempty"`
 }
 
 //LogDetails log details
@@ -116,6 +267,277 @@ type LogStructure struct {
 	Message        int    `json:"message"`
 	DateFormat     string `json:"dateFormat"`
 	JavaDateFormat string `json:"javaDateFormat"`
+	//RecordStart regex for first line of multi-line record, derived from DateFormat when empty
+	RecordStart string `json:"recordStart"`
+	//Sorted records are ordered by time, time range lookups use binary search
+	Sorted bool `json:"sorted"`
+	//Format delimited (default), regex, json or logfmt, Date, User, Reqid, Level and Message
+	//are token indexes of delimited format only, negative index when log does not have the field
+	Format string `json:"format"`
+	//Delimiter of delimited format, | when empty, space splits on runs of white space
+	Delimiter string `json:"delimiter"`
+	//Pattern regex with named groups date, level, user, reqid and message of regex format
+	Pattern string `json:"pattern"`
+	//Fields maps date, level, user, reqid and message to regex group, json field path (a.b.c)
+	//or logfmt key when they are named differently
+	Fields map[string]string `json:"fields"`
+}
+
+const (
+	//FormatDelimited tokens split by delimiter
+	FormatDelimited = "delimited"
+	//FormatRegex regex with named groups
+	FormatRegex = "regex"
+	//FormatJSON json object per line
+	FormatJSON = "json"
+	//FormatLogfmt key=value pairs
+	FormatLogfmt = "logfmt"
+)
+
+//ReadRequest reads lines of log around line number or byte offset
+type ReadRequest struct {
+	Log string `json:"log"`
+	//File rotated file of log to read, as in GrepLine.File
+	File string `json:"file"`
+	//Line 1-based line number, addresses line when Offset is 0
+	Line int `json:"line"`
+	//Offset byte offset, addresses line containing it, Line is then its line number when known
+	Offset int64 `json:"offset"`
+	//Backward reads lines before addressed line, without address the last lines of log
+	Backward bool `json:"backward"`
+	//Lines number of lines to read
+	Lines int `json:"lines"`
+}
+
+//ReadResponse lines read, scroll backward from Start and forward from End
+type ReadResponse struct {
+	LogFile string     `json:"logfile"`
+	File    string     `json:"file,omitempty"`
+	Lines   []GrepLine `json:"lines"`
+	//Start offset of first line
+	Start int64 `json:"start"`
+	//End offset after last line
+	End  int64 `json:"end"`
+	Size int64 `json:"size"`
+	//BOF first line is first line of file
+	BOF bool `json:"bof"`
+	//EOF last line is last line of file
+	EOF bool `json:"eof"`
+}
+
+//TraceRequest finds records of request id across logs
+type TraceRequest struct {
+	ReqID string     `json:"reqid"`
+	Logs  []TraceLog `json:"logs"`
+	//FromTime and ToTime epoch millis, [from, to) window, 0 is open bound
+	FromTime int64 `json:"fromTime"`
+	ToTime   int64 `json:"toTime"`
+	//History searches the whole rotation chain of every log
+	History bool `json:"history"`
+}
+
+//TraceLog log with its structure
+type TraceLog struct {
+	Log          string        `json:"log"`
+	LogStructure *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+}
+
+//TraceResponse records of request id from all logs ordered by time
+type TraceResponse struct {
+	ReqID string      `json:"reqid"`
+	Steps []TraceStep `json:"steps"`
+	//Duration millis between first and last timed step
+	Duration int64  `json:"duration"`
+	Host     string `json:"host"`
+	//Errors per log which could not be searched
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+//TraceStep single record of traced request, steps without parsable time are last with zero Time
+type TraceStep struct {
+	GrepLine
+	Log string `json:"log"`
+	//Time epoch millis
+	Time int64 `json:"time"`
+	//Elapsed millis since previous step
+	Elapsed int64 `json:"elapsed"`
+	//SinceStart millis since first step
+	SinceStart int64 `json:"sinceStart"`
+}
+
+//IndexRequest index log and keep its index up to date
+type IndexRequest struct {
+	Log          string        `json:"log"`
+	LogStructure *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+}
+
+//AlertRule alert fires when more than Threshold records of log match within window
+type AlertRule struct {
+	Name         string        `json:"name"`
+	Log          string        `json:"log"`
+	LogStructure *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+	//Pattern substring or regex, with LogStructure matched against message of record
+	Pattern       string `json:"pattern"`
+	Mode          string `json:"mode"`
+	CaseSensitive bool   `json:"caseSensitive"`
+	//Level records of level, needs LogStructure
+	Level     string `json:"level"`
+	Threshold int    `json:"threshold"`
+	//WindowSec and CooldownSec seconds, rule does not fire again until cooldown passed
+	WindowSec   int64       `json:"windowSec"`
+	CooldownSec int64       `json:"cooldownSec"`
+	Sinks       []AlertSink `json:"sinks"`
+}
+
+//AlertSink where alerts are sent, webhook posts alert to URL, file appends it to Path
+type AlertSink struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+const (
+	//AlertSinkWebhook posts alert as json
+	AlertSinkWebhook = "webhook"
+	//AlertSinkFile appends alert as json line to file
+	AlertSinkFile = "file"
+	//AlertSinkStdout prints alert
+	AlertSinkStdout = "stdout"
+)
+
+//Alert fired alert
+type Alert struct {
+	Rule      string `json:"rule"`
+	Log       string `json:"log"`
+	Host      string `json:"host"`
+	Count     int    `json:"count"`
+	Threshold int    `json:"threshold"`
+	WindowSec int64  `json:"windowSec"`
+	//Time epoch millis
+	Time int64 `json:"time"`
+	//Lines last matching lines
+	Lines []string `json:"lines"`
+}
+
+//AlertRuleState state of rule, Active while count in window is over threshold
+type AlertRuleState struct {
+	Rule   AlertRule `json:"rule"`
+	Count  int       `json:"count"`
+	Active bool      `json:"active"`
+	//LastFired epoch millis, 0 when rule has not fired
+	LastFired int64  `json:"lastFired"`
+	Error     string `json:"error,omitempty"`
+}
+
+//AlertsResponse rules and alerts fired recently, newest first
+type AlertsResponse struct {
+	Rules []AlertRuleState `json:"rules"`
+	Fired []Alert          `json:"fired"`
+}
+
+//HistogramRequest counts records of log per time bucket and level
+type HistogramRequest struct {
+	Log          string        `json:"log"`
+	LogStructure *LogStructure `json:"logStructure"`
+	//Profile name of registered log structure, used when LogStructure is not set
+	Profile string `json:"profile"`
+	//FromTime and ToTime epoch millis, [from, to) window, 0 is open bound
+	FromTime int64 `json:"fromTime"`
+	ToTime   int64 `json:"toTime"`
+	//History reads the whole rotation chain of the log
+	History bool `json:"history"`
+	//Interval minute, 5m, hour or day, auto (default) picks the shortest interval with at most
+	//HistogramMaxAutoBuckets buckets
+	Interval string `json:"interval"`
+}
+
+//HistogramBucket records of bucket starting at Time epoch millis, Levels counts records by
+//upper case level, records without level are in Total only
+type HistogramBucket struct {
+	Time   int64          `json:"time"`
+	Total  int            `json:"total"`
+	Levels map[string]int `json:"levels"`
+}
+
+//HistogramResponse buckets ordered by time, empty buckets between first and last are included
+type HistogramResponse struct {
+	Log      string            `json:"log"`
+	Interval string            `json:"interval"`
+	Buckets  []HistogramBucket `json:"buckets"`
+	//Unparsed records without parsable time
+	Unparsed int `json:"unparsed"`
+}
+
+const (
+	//HistogramAuto interval picked from time span of records
+	HistogramAuto = "auto"
+	//HistogramMinute minute buckets
+	HistogramMinute = "minute"
+	//Histogram5Minutes five minutes buckets
+	Histogram5Minutes = "5m"
+	//HistogramHour hour buckets
+	HistogramHour = "hour"
+	//HistogramDay day buckets
+	HistogramDay = "day"
+	//HistogramMaxAutoBuckets max buckets of auto interval, day buckets may exceed it
+	HistogramMaxAutoBuckets = 120
+)
+
+//Profile named log structure, presets are built in and cannot be changed
+type Profile struct {
+	Name         string        `json:"name"`
+	LogStructure *LogStructure `json:"logStructure"`
+	Preset       bool          `json:"preset"`
+}
+
+//DetectRequest detect structure of log
+type DetectRequest struct {
+	Log string `json:"log"`
+}
+
+//DetectResponse proposed log structure, Confidence 0 to 1 per format and date, level, user,
+//reqid and message, fields with 0 were not found
+type DetectResponse struct {
+	Log          string             `json:"log"`
+	LogStructure *LogStructure      `json:"logStructure"`
+	Confidence   map[string]float64 `json:"confidence"`
+	//Lines sampled from head and tail of log
+	Lines int `json:"lines"`
+}
+
+//IndexStatus indexed files of log
+type IndexStatus struct {
+	Log string `json:"log"`
+	//State IndexIndexing while log is indexed in background, IndexReady or IndexFailed
+	State string        `json:"state"`
+	Error string        `json:"error,omitempty"`
+	Files []IndexedFile `json:"files"`
+}
+
+const (
+	//IndexIndexing log is being indexed
+	IndexIndexing = "indexing"
+	//IndexReady last update of index succeeded
+	IndexReady = "ready"
+	//IndexFailed last update of index failed
+	IndexFailed = "failed"
+)
+
+//IndexedFile index state of single file
+type IndexedFile struct {
+	File string `json:"file"`
+	//Indexed bytes, the rest of file is scanned
+	Indexed  int64 `json:"indexed"`
+	Size     int64 `json:"size"`
+	Terms    int   `json:"terms"`
+	Segments int   `json:"segments"`
+	Tokens   bool  `json:"tokens"`
 }
 
 //CollectStatsRequest collect stats
@@ -130,19 +552,124 @@ type CollectStatsRsults struct {
 	TotalRequests int32                     `json:"totalRequests"`
 }
 
+const (
+	//QueryPlain case insensitive substring query, default
+	QueryPlain = "plain"
+	//QueryRegex regular expression query
+	QueryRegex = "regex"
+	//QueryBoolean boolean expression query with AND, OR, NOT and quoted phrases
+	QueryBoolean = "boolean"
+)
+
+const (
+	//FieldReqID record request id
+	FieldReqID = "reqid"
+	//FieldUser record user
+	FieldUser = "user"
+	//FieldToken any whitespace or delimiter separated token of record first line
+	FieldToken = "token"
+)
+
+const (
+	//TailEventRotated log was rotated, lines are read from start of new file
+	TailEventRotated = "rotated"
+	//TailEventTruncated log was truncated, lines are read from its start
+	TailEventTruncated = "truncated"
+)
+
+//TailMessage message from client of multiplexed tail session
+type TailMessage struct {
+	Type string `json:"type"`
+	//ID of subscription chosen by client, defaults to host and log of request
+	ID string `json:"id"`
+	//Host tails log of remote host, empty is local host
+	Host    string      `json:"host"`
+	Request *LogRequest `json:"request"`
+}
+
+//TailFrame message pushed to client of multiplexed tail session
+type TailFrame struct {
+	Type  string           `json:"type"`
+	ID    string           `json:"id"`
+	Log   string           `json:"log"`
+	Host  string           `json:"host"`
+	Tail  *TailLogResponse `json:"tail,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+const (
+	//TailSubscribe subscribes to log
+	TailSubscribe = "subscribe"
+	//TailUnsubscribe stops subscription
+	TailUnsubscribe = "unsubscribe"
+	//TailPause stops pushing lines of subscription, they are pushed after resume
+	TailPause = "pause"
+	//TailResume resumes paused subscription
+	TailResume = "resume"
+	//TailFrameLines lines appended to log
+	TailFrameLines = "tail"
+	//TailFrameSubscribed subscribe acknowledged
+	TailFrameSubscribed = "subscribed"
+	//TailFrameUnsubscribed unsubscribe acknowledged
+	TailFrameUnsubscribed = "unsubscribed"
+	//TailFramePaused pause acknowledged
+	TailFramePaused = "paused"
+	//TailFrameResumed resume acknowledged
+	TailFrameResumed = "resumed"
+	//TailFrameError invalid message or subscription failed
+	TailFrameError = "error"
+)
+
+const (
+	//GrepEventMatch match found
+	GrepEventMatch = "match"
+	//GrepEventProgress bytes scanned so far out of total
+	GrepEventProgress = "progress"
+	//GrepEventError log could not be searched
+	GrepEventError = "error"
+	//GrepEventCursor log stopped at max results, cursor resumes it
+	GrepEventCursor = "cursor"
+	//GrepEventDone search finished
+	GrepEventDone = "done"
+)
+
 const (
 	//SearchEndpoint search
 	SearchEndpoint = "search"
+	//SearchStreamEndpoint search streaming ndjson events
+	SearchStreamEndpoint = "search/stream"
+	//SearchWSEndpoint search streaming events over websocket
+	SearchWSEndpoint = "search/ws"
+	//TailSessionWSEndpoint tail of multiple logs over single websocket
+	TailSessionWSEndpoint = "tail-log/session"
 	//ListLogsEndpoint list logs
 	ListLogsEndpoint = "list-logs"
 	//DownloadLogEndpoint download log
 	DownloadLogEndpoint = "download-log"
 	//TailLogEndpoint tail log
 	TailLogEndpoint = "tail-log"
+	//TailLogStreamEndpoint live tail log as server sent events
+	TailLogStreamEndpoint = "tail-log/stream"
 	//StatsEndpoint stats
 	StatsEndpoint = "stats"
 	//ErrorsEndpoint errors
 	ErrorsEndpoint = "errors"
 	//CollectStatsEndpoint collect stats
 	CollectStatsEndpoint = "collect-stats"
+	//IndexEndpoint index log
+	IndexEndpoint = "index"
+	//TraceEndpoint trace request id across logs
+	TraceEndpoint = "trace"
+	//ReadEndpoint read lines by line number or offset
+	ReadEndpoint = "read"
+	//AlertsEndpoint alert rules and fired alerts
+	AlertsEndpoint = "alerts"
+	//DetectStructureEndpoint propose log structure of log
+	DetectStructureEndpoint = "detect-structure"
+	//ErrorGroupsEndpoint errors grouped by fingerprint
+	ErrorGroupsEndpoint = "error-groups"
+	//HistogramEndpoint record counts per time bucket and level
+	HistogramEndpoint = "histogram"
+	//ProfilesEndpoint lists, saves (POST) and deletes (DELETE ?name=) log structure profiles
+	ProfilesEndpoint = "profiles"
 )
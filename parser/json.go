@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//jsonParser json object per line, nested fields are addressed by dotted path
+type jsonParser struct {
+	keys map[string]string
+}
+
+func (p *jsonParser) Parse(rec string) (*Record, bool) {
+	first, rest := split(rec)
+	first = strings.TrimSpace(first)
+	if !strings.HasPrefix(first, "{") {
+		return nil, false
+	}
+	d := json.NewDecoder(strings.NewReader(first))
+	d.UseNumber()
+	var obj map[string]interface{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(obj))
+	flatten("", obj, fields)
+	return record(fields, p.keys, rest), true
+}
+
+//flatten flattens nested objects to dotted paths
+func flatten(prefix string, obj map[string]interface{}, fields map[string]string) {
+	for k, v := range obj {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(k, v, fields)
+		case string:
+			fields[k] = v
+		case nil:
+			fields[k] = ""
+		case json.Number, bool:
+			fields[k] = fmt.Sprint(v)
+		default:
+			var b bytes.Buffer
+			json.NewEncoder(&b).Encode(v)
+			fields[k] = strings.TrimSpace(b.String())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"strings"
+)
+
+//logfmtParser key=value pairs, values with spaces are quoted
+type logfmtParser struct {
+	keys map[string]string
+}
+
+func (p *logfmtParser) Parse(rec string) (*Record, bool) {
+	first, rest := split(rec)
+	fields, pairs := logfmt(first)
+	if pairs == 0 {
+		return nil, false
+	}
+	return record(fields, p.keys, rest), true
+}
+
+//logfmt parses key=value pairs, key without value is empty, returns number of pairs with value
+func logfmt(line string) (map[string]string, int) {
+	fields := make(map[string]string)
+	pairs := 0
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			i++
+			continue
+		}
+		if i >= len(line) || line[i] != '=' {
+			fields[key] = ""
+			continue
+		}
+		i++
+		pairs++
+		if i < len(line) && line[i] == '"' {
+			var sb strings.Builder
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				sb.WriteByte(line[i])
+			}
+			i++
+			fields[key] = sb.String()
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+	return fields, pairs
+}
@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+const (
+	//Date field name
+	Date = "date"
+	//Level field name
+	Level = "level"
+	//User field name
+	User = "user"
+	//ReqID field name
+	ReqID = "reqid"
+	//Message field name
+	Message = "message"
+)
+
+//defaultKeys keys of fields in json and logfmt records
+var defaultKeys = map[string]string{Date: "time", Level: "level", User: "user", ReqID: "reqid", Message: "msg"}
+
+//Record structured record
+type Record struct {
+	Date    string
+	Level   string
+	User    string
+	ReqID   string
+	Message string
+	//Fields all named fields of regex, json and logfmt records
+	Fields map[string]string
+}
+
+//Parser parses records of log
+type Parser interface {
+	//Parse parses record, continuation lines are part of message, false when first line
+	//does not have structure of log
+	Parse(rec string) (*Record, bool)
+}
+
+//cacheSize parsers cached by log structure
+var cacheSize = 128
+
+//cache parsers by serialized log structure, log structure changed by caller gets new parser
+var cache = struct {
+	sync.RWMutex
+	parsers map[string]Parser
+}{parsers: make(map[string]Parser)}
+
+//Of parser of log structure, parsers are cached by serialized log structure so it is resolved
+//once per request or scanner, not per record
+func Of(ls *model.LogStructure) (Parser, error) {
+	if ls == nil {
+		return nil, fmt.Errorf("Missing log structure")
+	}
+	b, err := json.Marshal(ls)
+	if err != nil {
+		return nil, fmt.Errorf("Could not serialize log structure, %v", err)
+	}
+	key := string(b)
+	cache.RLock()
+	p, ok := cache.parsers[key]
+	cache.RUnlock()
+	if ok {
+		return p, nil
+	}
+	p, err = New(ls)
+	if err != nil {
+		return nil, err
+	}
+	cache.Lock()
+	if len(cache.parsers) >= cacheSize {
+		cache.parsers = make(map[string]Parser)
+	}
+	cache.parsers[key] = p
+	cache.Unlock()
+	return p, nil
+}
+
+//New parser of log structure
+func New(ls *model.LogStructure) (Parser, error) {
+	switch ls.Format {
+	case "", model.FormatDelimited:
+		return newDelimited(ls), nil
+	case model.FormatRegex:
+		return newRegex(ls)
+	case model.FormatJSON:
+		return &jsonParser{keys: keys(ls)}, nil
+	case model.FormatLogfmt:
+		return &logfmtParser{keys: keys(ls)}, nil
+	}
+	return nil, fmt.Errorf("Unknown log format %v", ls.Format)
+}
+
+//maxTokens max token index of delimited format
+const maxTokens = 64
+
+//Validate validates log structure, token indexes of delimited format have to be in range and
+//distinct, fields of regex format have to name groups of pattern
+func Validate(ls *model.LogStructure) error {
+	if ls == nil {
+		return fmt.Errorf("Missing log structure")
+	}
+	p, err := New(ls)
+	if err != nil {
+		return err
+	}
+	switch p := p.(type) {
+	case *delimited:
+		names := []string{Date, User, ReqID, Level, Message}
+		seen := make(map[int]string)
+		for i, idx := range []int{ls.Date, ls.User, ls.Reqid, ls.Level, ls.Message} {
+			if idx < -1 || idx >= maxTokens {
+				return fmt.Errorf("Index %v of %v is out of range, -1 to %v", idx, names[i], maxTokens-1)
+			}
+			if f, ok := seen[idx]; ok && idx >= 0 {
+				return fmt.Errorf("Fields %v and %v have the same index %v", f, names[i], idx)
+			}
+			seen[idx] = names[i]
+		}
+	case *regexParser:
+		groups := make(map[string]bool)
+		for _, n := range p.re.SubexpNames() {
+			groups[n] = n != ""
+		}
+		for f, g := range ls.Fields {
+			if !groups[g] {
+				return fmt.Errorf("Log pattern '%v' has no group %v for %v", ls.Pattern, g, f)
+			}
+		}
+	}
+	return nil
+}
+
+//keys keys of record fields, defaults overridden by log structure
+func keys(ls *model.LogStructure) map[string]string {
+	k := make(map[string]string, len(defaultKeys))
+	for f, v := range defaultKeys {
+		k[f] = v
+	}
+	for f, v := range ls.Fields {
+		k[f] = v
+	}
+	return k
+}
+
+//split first line of record and continuation lines
+func split(rec string) (string, string) {
+	if i := strings.IndexByte(rec, '\n'); i >= 0 {
+		return rec[:i], rec[i:]
+	}
+	return rec, ""
+}
+
+//record record of named fields
+func record(fields map[string]string, keys map[string]string, rest string) *Record {
+	return &Record{
+		Date:    fields[keys[Date]],
+		Level:   fields[keys[Level]],
+		User:    fields[keys[User]],
+		ReqID:   fields[keys[ReqID]],
+		Message: fields[keys[Message]] + rest,
+		Fields:  fields,
+	}
+}
+
+//delimited tokens split by delimiter, fields are addressed by token index
+type delimited struct {
+	ls    model.LogStructure
+	delim string
+	max   int
+}
+
+func newDelimited(ls *model.LogStructure) *delimited {
+	d := &delimited{ls: *ls, delim: ls.Delimiter}
+	if d.delim == "" {
+		d.delim = "|"
+	}
+	for _, i := range []int{ls.Date, ls.User, ls.Reqid, ls.Level, ls.Message} {
+		if i > d.max {
+			d.max = i
+		}
+	}
+	return d
+}
+
+//token trimmed token, negative index means log does not have the field
+func token(tokens []string, i int) string {
+	if i < 0 || i >= len(tokens) {
+		return ""
+	}
+	return strings.TrimSpace(tokens[i])
+}
+
+func (d *delimited) Parse(rec string) (*Record, bool) {
+	first, rest := split(rec)
+	var tokens []string
+	if d.delim == " " {
+		tokens = strings.Fields(first)
+	} else {
+		tokens = strings.Split(first, d.delim)
+	}
+	if len(tokens) <= d.max {
+		return nil, false
+	}
+	ls := d.ls
+	msg := rest
+	if ls.Message >= 0 && ls.Message < len(tokens) {
+		msg = strings.TrimSpace(strings.Join(tokens[ls.Message:], d.delim)) + rest
+	}
+	return &Record{
+		Date:    token(tokens, ls.Date),
+		Level:   token(tokens, ls.Level),
+		User:    token(tokens, ls.User),
+		ReqID:   token(tokens, ls.Reqid),
+		Message: msg,
+	}, true
+}
+
+//regexParser first line matched by regex with named groups
+type regexParser struct {
+	re   *regexp.Regexp
+	keys map[string]string
+}
+
+func newRegex(ls *model.LogStructure) (*regexParser, error) {
+	re, err := regexp.Compile(ls.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid log pattern '%v', %v", ls.Pattern, err)
+	}
+	named := false
+	for _, n := range re.SubexpNames() {
+		named = named || n != ""
+	}
+	if !named {
+		return nil, fmt.Errorf("Log pattern '%v' has no named groups", ls.Pattern)
+	}
+	k := make(map[string]string, 5)
+	for _, f := range []string{Date, Level, User, ReqID, Message} {
+		k[f] = f
+	}
+	for f, v := range ls.Fields {
+		k[f] = v
+	}
+	return &regexParser{re: re, keys: k}, nil
+}
+
+func (p *regexParser) Parse(rec string) (*Record, bool) {
+	first, rest := split(rec)
+	m := p.re.FindStringSubmatch(first)
+	if m == nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(m))
+	for i, n := range p.re.SubexpNames() {
+		if n != "" {
+			fields[n] = strings.TrimSpace(m[i])
+		}
+	}
+	return record(fields, p.keys, rest), true
+}
+
+//Pattern regex of regex format, first lines of records match it
+func Pattern(ls *model.LogStructure) (*regexp.Regexp, error) {
+	if ls == nil || ls.Format != model.FormatRegex {
+		return nil, nil
+	}
+	p, err := Of(ls)
+	if err != nil {
+		return nil, err
+	}
+	return p.(*regexParser).re, nil
+}
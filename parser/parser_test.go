@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name string
+		ls   *model.LogStructure
+		rec  string
+		want Record
+	}{
+		{"pipe", &model.LogStructure{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6},
+			"2021-05-06 11:27:58,455|exec-1|ERROR|Handler|ab12345|req-1|failed|again\n\tat App.run",
+			Record{Date: "2021-05-06 11:27:58,455", Level: "ERROR", User: "ab12345", ReqID: "req-1", Message: "failed|again\n\tat App.run"}},
+		{"space padded", &model.LogStructure{Date: 0, Level: 1, User: 2, Reqid: 3, Message: 4, Delimiter: " "},
+			"2021-05-06T11:27:58   WARN  ab12345  req-2  disk almost full",
+			Record{Date: "2021-05-06T11:27:58", Level: "WARN", User: "ab12345", ReqID: "req-2", Message: "disk almost full"}},
+		{"nginx combined", &model.LogStructure{Format: model.FormatRegex,
+			Pattern: `^(?P<ip>\S+) \S+ (?P<user>\S+) \[(?P<date>[^\]]+)\] "(?P<message>[^"]*)" (?P<status>\d{3}) (?P<bytes>\d+)`,
+			Fields:  map[string]string{Level: "status"}},
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 404 2326 "-" "curl"`,
+			Record{Date: "10/Oct/2000:13:55:36 -0700", Level: "404", User: "frank", Message: "GET /index.html HTTP/1.0"}},
+		{"json", &model.LogStructure{Format: model.FormatJSON, Fields: map[string]string{ReqID: "ctx.reqid", Date: "ts"}},
+			`{"ts":"2021-05-06T11:27:58Z","level":"error","msg":"failed","ctx":{"reqid":"req-3","attempt":2}}`,
+			Record{Date: "2021-05-06T11:27:58Z", Level: "error", ReqID: "req-3", Message: "failed"}},
+		{"logfmt", &model.LogStructure{Format: model.FormatLogfmt},
+			`time=2021-05-06T11:27:58Z level=info user=ab12345 msg="user \"ab\" logged in" reqid=req-4`,
+			Record{Date: "2021-05-06T11:27:58Z", Level: "info", User: "ab12345", ReqID: "req-4", Message: `user "ab" logged in`}},
+	}
+	for _, tt := range tests {
+		p, err := New(tt.ls)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		rec, ok := p.Parse(tt.rec)
+		if !ok {
+			t.Fatalf("%v: expected record to be parsed", tt.name)
+		}
+		rec.Fields = nil
+		if !reflect.DeepEqual(*rec, tt.want) {
+			t.Errorf("%v: expected %+v, got %+v", tt.name, tt.want, *rec)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, ls := range []*model.LogStructure{
+		{Format: "xml"},
+		{Format: model.FormatRegex, Pattern: `(\d+`},
+		{Format: model.FormatRegex, Pattern: `\d+`},
+	} {
+		if _, err := New(ls); err == nil {
+			t.Errorf("expected %+v to be invalid", ls)
+		}
+	}
+	tests := map[string]*model.LogStructure{
+		"a|b":             {Message: 3},
+		"plain text line": {Format: model.FormatLogfmt},
+		"\tat App.run":    {Format: model.FormatJSON},
+	}
+	for line, ls := range tests {
+		p, _ := New(ls)
+		if _, ok := p.Parse(line); ok {
+			t.Errorf("expected '%v' not to be parsed with %+v", line, ls)
+		}
+	}
+	json, _ := New(&model.LogStructure{Format: model.FormatJSON})
+	if rec, ok := json.Parse(`{"level":"info","n":1.5,"tags":["a","b"]}`); !ok || rec.Fields["n"] != "1.5" || rec.Fields["tags"] != `["a","b"]` {
+		t.Errorf("expected fields of json record, got %+v", rec)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, ls := range []*model.LogStructure{
+		{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6},
+		{Date: 0, Level: 1, User: -1, Reqid: -1, Message: 2, Delimiter: "\t"},
+		{Format: model.FormatRegex, Pattern: `^(?P<date>\S+) (?P<status>\d+) (?P<message>.*)`, Fields: map[string]string{Level: "status"}},
+		{Format: model.FormatJSON},
+	} {
+		if err := Validate(ls); err != nil {
+			t.Errorf("expected %+v to be valid, %v", ls, err)
+		}
+	}
+	for _, ls := range []*model.LogStructure{
+		nil,
+		{Date: 0, Level: 2, User: 2, Reqid: 5, Message: 6},
+		{Date: 0, Level: -2, User: 4, Reqid: 5, Message: 6},
+		{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 64},
+		{Format: model.FormatRegex, Pattern: `^(?P<date>\S+) (?P<message>.*)`, Fields: map[string]string{Level: "status"}},
+	} {
+		if err := Validate(ls); err == nil {
+			t.Errorf("expected %+v to be invalid", ls)
+		}
+	}
+}
+
+func TestOfChangedStructure(t *testing.T) {
+	ls := &model.LogStructure{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6}
+	line := "2021-05-06 11:27:58,455|exec-1|ERROR|Handler|ab12345|req-1|failed"
+	p, _ := Of(ls)
+	if rec, ok := p.Parse(line); !ok || rec.User != "ab12345" {
+		t.Fatalf("expected user, got %+v", rec)
+	}
+	ls.User = 7
+	p, _ = Of(ls)
+	if rec, ok := p.Parse(line); ok {
+		t.Errorf("expected line without user token not to be parsed, got %+v", rec)
+	}
+	if rec, ok := p.Parse(line + "|cd67890"); !ok || rec.User != "cd67890" {
+		t.Errorf("expected parser of changed structure, got %+v", rec)
+	}
+	ls.Format, ls.Pattern = model.FormatRegex, `^(?P<date>\S+ \S+)\|(?P<message>.*)`
+	if re, err := Pattern(ls); err != nil || re.String() != ls.Pattern {
+		t.Errorf("expected pattern of changed structure, got %v %v", re, err)
+	}
+}
@@ -0,0 +1,188 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//presets built in profiles
+var presets = map[string]*model.LogStructure{
+	//log4j and logback pattern %d|%t|%p|%c|%X{user}|%X{reqid}|%m%n
+	"log4j-pipe": {Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6, DateFormat: "2006-01-02 15:04:05,000"},
+	//go standard log with log.LstdFlags
+	"go-log": {Format: model.FormatRegex, DateFormat: "2006/01/02 15:04:05",
+		Pattern: `^(?P<date>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?:\.\d+)? (?P<message>.*)$`},
+	//nginx combined access log, status is level
+	"nginx": {Format: model.FormatRegex, DateFormat: "02/Jan/2006:15:04:05 -0700",
+		Pattern: `^(?P<ip>\S+) \S+ (?P<user>\S+) \[(?P<date>[^\]]+)\] "(?P<message>[^"]*)" (?P<status>\d{3}) (?P<bytes>\d+)`,
+		Fields:  map[string]string{parser.Level: "status"}},
+	//json object per line with time, level, msg, user and reqid keys
+	"json": {Format: model.FormatJSON, DateFormat: "2006-01-02T15:04:05Z07:00"},
+}
+
+//Registry named log structures, presets are built in, profiles saved to registry are written
+//to its file
+type Registry struct {
+	path     string
+	mu       sync.RWMutex
+	profiles map[string]*model.LogStructure
+}
+
+//NewRegistry registry with presets
+func NewRegistry() *Registry {
+	return &Registry{profiles: make(map[string]*model.LogStructure)}
+}
+
+//Load reads profiles from json file of name to log structure, saved profiles are written to it,
+//missing file is created on first save
+func (r *Registry) Load(path string) error {
+	profiles := make(map[string]*model.LogStructure)
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("Could not read profiles, %v", err)
+	default:
+		if err := json.Unmarshal(b, &profiles); err != nil {
+			return fmt.Errorf("Could not parse profiles %v, %v", path, err)
+		}
+	}
+	for name, ls := range profiles {
+		if err := validate(name, ls); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path, r.profiles = path, profiles
+	return nil
+}
+
+//Get log structure of profile, it is shared and must not be modified
+func (r *Registry) Get(name string) (*model.LogStructure, error) {
+	if ls, ok := presets[name]; ok {
+		return ls, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if ls, ok := r.profiles[name]; ok {
+		return ls, nil
+	}
+	return nil, fmt.Errorf("Unknown profile %v", name)
+}
+
+//Resolve sets log structure of profile when profile is requested instead of log structure,
+//log structure sent with request is validated like saved profiles
+func (r *Registry) Resolve(profile string, ls **model.LogStructure) error {
+	if profile == "" {
+		if *ls == nil {
+			return nil
+		}
+		if err := parser.Validate(*ls); err != nil {
+			return fmt.Errorf("Invalid log structure, %v", err)
+		}
+		return nil
+	}
+	if *ls != nil {
+		return fmt.Errorf("Request has both profile %v and log structure", profile)
+	}
+	p, err := r.Get(profile)
+	if err != nil {
+		return err
+	}
+	*ls = p
+	return nil
+}
+
+//List presets and profiles ordered by name
+func (r *Registry) List() []model.Profile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]model.Profile, 0, len(presets)+len(r.profiles))
+	for name, ls := range presets {
+		res = append(res, model.Profile{Name: name, LogStructure: ls, Preset: true})
+	}
+	for name, ls := range r.profiles {
+		res = append(res, model.Profile{Name: name, LogStructure: ls})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+//Save validates and saves profile, existing profile is replaced
+func (r *Registry) Save(p model.Profile) error {
+	if err := validate(p.Name, p.LogStructure); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.profiles[p.Name]
+	r.profiles[p.Name] = p.LogStructure
+	if err := r.write(); err != nil {
+		if ok {
+			r.profiles[p.Name] = old
+		} else {
+			delete(r.profiles, p.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+//Delete deletes profile
+func (r *Registry) Delete(name string) error {
+	if _, ok := presets[name]; ok {
+		return fmt.Errorf("Preset %v cannot be deleted", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ls, ok := r.profiles[name]
+	if !ok {
+		return fmt.Errorf("Unknown profile %v", name)
+	}
+	delete(r.profiles, name)
+	if err := r.write(); err != nil {
+		r.profiles[name] = ls
+		return err
+	}
+	return nil
+}
+
+//write writes profiles to file of registry, temp file is renamed so file is never half written
+func (r *Registry) write() error {
+	if r.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(r.profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Could not serialize profiles, %v", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("Could not write profiles, %v", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("Could not write profiles, %v", err)
+	}
+	return nil
+}
+
+func validate(name string, ls *model.LogStructure) error {
+	if name == "" {
+		return fmt.Errorf("Missing profile name")
+	}
+	if _, ok := presets[name]; ok {
+		return fmt.Errorf("Profile %v is a preset", name)
+	}
+	if err := parser.Validate(ls); err != nil {
+		return fmt.Errorf("Invalid profile %v, %v", name, err)
+	}
+	return nil
+}
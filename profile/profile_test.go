@@ -0,0 +1,97 @@
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+func TestPresets(t *testing.T) {
+	for name, ls := range presets {
+		if err := parser.Validate(ls); err != nil {
+			t.Errorf("invalid preset %v, %v", name, err)
+		}
+	}
+	nginx, _ := parser.New(presets["nginx"])
+	rec, ok := nginx.Parse(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 404 2326 "-" "curl"`)
+	if !ok || rec.Level != "404" || rec.User != "frank" {
+		t.Errorf("expected nginx record, got %+v", rec)
+	}
+	goLog, _ := parser.New(presets["go-log"])
+	if rec, ok = goLog.Parse("2021/05/06 11:27:58.123456 server started"); !ok || rec.Date != "2021/05/06 11:27:58" || rec.Message != "server started" {
+		t.Errorf("expected go log record, got %+v", rec)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profiles.json")
+	r := NewRegistry()
+	if err = r.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	app := &model.LogStructure{Date: 1, Level: 0, User: -1, Reqid: -1, Message: 2, Delimiter: ";", DateFormat: "2006-01-02"}
+	if err = r.Save(model.Profile{Name: "app", LogStructure: app}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []model.Profile{
+		{Name: "dup", LogStructure: &model.LogStructure{Date: 0, Level: 1, User: 1, Reqid: 2, Message: 3}},
+		{Name: "range", LogStructure: &model.LogStructure{Date: 0, Level: 1, User: -5, Reqid: 2, Message: 3}},
+		{Name: "json", LogStructure: &model.LogStructure{Format: model.FormatJSON}},
+		{Name: "", LogStructure: app},
+	} {
+		if err := r.Save(p); err == nil {
+			t.Errorf("expected profile %v to be rejected", p.Name)
+		}
+	}
+	if err = r.Delete("json"); err == nil {
+		t.Error("expected preset not to be deleted")
+	}
+
+	loaded := NewRegistry()
+	if err = loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if ls, err := loaded.Get("app"); err != nil || ls.Delimiter != ";" || ls.Date != 1 {
+		t.Fatalf("expected saved profile, got %+v %v", ls, err)
+	}
+	if len(loaded.List()) != len(presets)+1 {
+		t.Errorf("expected presets and saved profile, got %+v", loaded.List())
+	}
+	req := model.StatsRequest{Profile: "log4j-pipe"}
+	if err = loaded.Resolve(req.Profile, &req.LogStructure); err != nil || req.LogStructure != presets["log4j-pipe"] {
+		t.Errorf("expected preset to be resolved, got %+v %v", req.LogStructure, err)
+	}
+	if err = loaded.Resolve("app", &req.LogStructure); err == nil {
+		t.Error("expected profile with log structure to fail")
+	}
+	//log structure of request is validated like profiles
+	inline := &model.LogStructure{Date: 1, Reqid: 0, Message: 2}
+	if err = loaded.Resolve("", &inline); err == nil {
+		t.Error("expected log structure with fields of same index to fail")
+	}
+	inline = &model.LogStructure{Date: 1, Reqid: 0, User: -1, Level: -1, Message: 2}
+	if err = loaded.Resolve("", &inline); err != nil {
+		t.Errorf("expected valid log structure, got %v", err)
+	}
+	if err = loaded.Delete("app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewRegistry().Get("app"); err == nil {
+		t.Error("expected deleted profile to be unknown")
+	}
+	if err = loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loaded.Get("app"); err == nil {
+		t.Error("expected deleted profile to be removed from file")
+	}
+}
@@ -0,0 +1,66 @@
+package search
+
+import "github.com/RomanLorens/logviewer-module/model"
+
+//contextCollector attaches before/after context to matches, overlapping windows are merged
+//the way GNU grep does - a line is never repeated and a matching line always starts its own match
+type contextCollector struct {
+	before    int
+	after     int
+	prev      []model.GrepLine
+	pending   *model.GrepMatch
+	afterLeft int
+}
+
+func newContextCollector(before int, after int) *contextCollector {
+	if before < 0 {
+		before = 0
+	}
+	if after < 0 {
+		after = 0
+	}
+	return &contextCollector{before: before, after: after}
+}
+
+//add adds next line and returns matches completed by it
+func (c *contextCollector) add(line model.GrepLine, matched bool) []model.GrepMatch {
+	var done []model.GrepMatch
+	switch {
+	case matched:
+		if c.pending != nil {
+			done = append(done, *c.pending)
+		}
+		c.pending = &model.GrepMatch{GrepLine: line, Before: c.prev}
+		c.prev = nil
+		c.afterLeft = c.after
+	case c.pending != nil:
+		c.pending.After = append(c.pending.After, line)
+		c.afterLeft--
+	case c.before > 0:
+		if len(c.prev) == c.before {
+			copy(c.prev, c.prev[1:])
+			c.prev = c.prev[:len(c.prev)-1]
+		}
+		c.prev = append(c.prev, line)
+	}
+	if c.pending != nil && c.afterLeft <= 0 {
+		done = append(done, *c.pending)
+		c.pending = nil
+	}
+	return done
+}
+
+//waiting true when last match still collects its after context
+func (c *contextCollector) waiting() bool {
+	return c.pending != nil
+}
+
+//flush returns match still waiting for its after context
+func (c *contextCollector) flush() []model.GrepMatch {
+	if c.pending == nil {
+		return nil
+	}
+	done := []model.GrepMatch{*c.pending}
+	c.pending = nil
+	return done
+}
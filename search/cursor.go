@@ -0,0 +1,48 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+//cursor position where paged grep stopped, Offset and LineNumber of first unread record in File,
+//in reverse mode Offset is end of unread part of File, 0 is end of file
+type cursor struct {
+	Log        string `json:"l"`
+	File       string `json:"f"`
+	Offset     int64  `json:"o"`
+	LineNumber int    `json:"n"`
+	Reverse    bool   `json:"r,omitempty"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor '%v', %v", s, err)
+	}
+	var c cursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("Invalid cursor '%v', %v", s, err)
+	}
+	return &c, nil
+}
+
+//findCursor cursor for log from cursors returned by previous grep
+func findCursor(cursors []string, log string) (*cursor, error) {
+	for _, s := range cursors {
+		c, err := decodeCursor(s)
+		if err != nil {
+			return nil, err
+		}
+		if c.Log == log {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
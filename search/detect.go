@@ -0,0 +1,398 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//detectSampleBytes bytes sampled from head and from tail of log
+var detectSampleBytes int64 = 64 * 1024
+
+//detectMinScore min share of sampled records a format or field has to fit
+const detectMinScore = 0.5
+
+//detectLayouts date layouts tried by detection, more specific first
+var detectLayouts = []string{
+	"2006-01-02 15:04:05,000",
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	"02-01-2006 15:04:05",
+	"Jan _2 15:04:05",
+	"2006-01-02",
+}
+
+var detectLevels = map[string]bool{"TRACE": true, "DEBUG": true, "INFO": true, "WARN": true, "WARNING": true,
+	"ERROR": true, "FATAL": true, "CRITICAL": true, "SEVERE": true, "NOTICE": true}
+
+//detectKeys key names of fields in json and logfmt records, compared without case, - and _
+var detectKeys = map[string][]string{
+	parser.Date:    {"time", "ts", "timestamp", "@timestamp", "date", "datetime"},
+	parser.Level:   {"level", "lvl", "severity", "loglevel", "log.level"},
+	parser.Message: {"msg", "message", "log", "text"},
+	parser.User:    {"user", "userid", "username", "uid", "user.id", "user.name"},
+	parser.ReqID:   {"reqid", "requestid", "traceid", "correlationid", "xrequestid"},
+}
+
+var (
+	threadLike = regexp.MustCompile(`(?i)(^main$|thread|exec-|pool-|worker|nio-|task-|scheduler)`)
+	classLike  = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)+$`)
+	reqidLike  = regexp.MustCompile(`^[\w@#:./+=-]{8,}$`)
+	userLike   = regexp.MustCompile(`^[A-Za-z][\w.@-]{1,31}$`)
+	hasDigit   = regexp.MustCompile(`\d`)
+)
+
+//DetectStructure samples head and tail of log and proposes its structure, json, logfmt and
+//delimited formats are tried first, white space padded logs get regex with date, level and message
+func DetectStructure(req *model.DetectRequest) (*model.DetectResponse, error) {
+	lines, err := sampleLines(req.Log)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("Could not detect structure of empty log %v", req.Log)
+	}
+	res := &model.DetectResponse{Log: req.Log, Lines: len(lines), Confidence: make(map[string]float64)}
+	for _, detect := range []func([]string, *model.DetectResponse) bool{detectJSON, detectLogfmt, detectDelimited, detectPadded} {
+		if detect(lines, res) {
+			for _, f := range []string{parser.Date, parser.Level, parser.User, parser.ReqID, parser.Message} {
+				if _, ok := res.Confidence[f]; !ok {
+					res.Confidence[f] = 0
+				}
+			}
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not detect structure of %v", req.Log)
+}
+
+//sampleLines non empty complete lines of head and tail of log
+func sampleLines(path string) ([]string, error) {
+	r, size, closer, err := openReaderAt(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open %v, %v", path, err)
+	}
+	defer closer.Close()
+	read := func(start, end int64) ([]string, error) {
+		b := make([]byte, end-start)
+		if n, err := r.ReadAt(b, start); n < len(b) {
+			return nil, err
+		}
+		lines := strings.Split(string(b), "\n")
+		if start > 0 {
+			lines = lines[1:]
+		}
+		if end < size {
+			lines = lines[:len(lines)-1]
+		}
+		return lines, nil
+	}
+	var lines []string
+	if size <= 2*detectSampleBytes {
+		lines, err = read(0, size)
+	} else {
+		var tail []string
+		if lines, err = read(0, detectSampleBytes); err == nil {
+			tail, err = read(size-detectSampleBytes, size)
+			lines = append(lines, tail...)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %v, %v", path, err)
+	}
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if l = NormalizeText(strings.TrimRight(l, "\r")); strings.TrimSpace(l) != "" {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func detectJSON(lines []string, res *model.DetectResponse) bool {
+	p, _ := parser.New(&model.LogStructure{Format: model.FormatJSON})
+	return detectKeyed(lines, res, p, model.FormatJSON, 1)
+}
+
+func detectLogfmt(lines []string, res *model.DetectResponse) bool {
+	p, _ := parser.New(&model.LogStructure{Format: model.FormatLogfmt})
+	return detectKeyed(lines, res, p, model.FormatLogfmt, 3)
+}
+
+//detectKeyed detects keys of fields of json or logfmt records with at least minFields non empty
+//fields, records need date, level or message
+func detectKeyed(lines []string, res *model.DetectResponse, p parser.Parser, format string, minFields int) bool {
+	records := make([]map[string]string, 0, len(lines))
+	for _, l := range lines {
+		rec, ok := p.Parse(l)
+		if !ok {
+			continue
+		}
+		n := 0
+		for _, v := range rec.Fields {
+			if v != "" {
+				n++
+			}
+		}
+		if n >= minFields {
+			records = append(records, rec.Fields)
+		}
+	}
+	score := float64(len(records)) / float64(len(lines))
+	if score < detectMinScore {
+		return false
+	}
+	ls := &model.LogStructure{Format: format, Fields: make(map[string]string)}
+	confidence := map[string]float64{"format": score}
+	keys := make(map[string]bool)
+	for _, r := range records {
+		for k := range r {
+			keys[k] = true
+		}
+	}
+	values := func(key string) []string {
+		v := make([]string, len(records))
+		for i, r := range records {
+			v[i] = r[key]
+		}
+		return v
+	}
+	for _, f := range []string{parser.Date, parser.Level, parser.Message, parser.User, parser.ReqID} {
+		best, bestScore, layout := "", 0.0, ""
+		for k := range keys {
+			if !isKeyOf(k, f) {
+				continue
+			}
+			var s float64
+			var l string
+			switch f {
+			case parser.Date:
+				l, s = dateScore(values(k))
+			case parser.Level:
+				s = levelScore(values(k))
+			default:
+				s = fraction(values(k), func(v string) bool { return v != "" })
+			}
+			if s > bestScore || (s == bestScore && k < best) {
+				best, bestScore, layout = k, s, l
+			}
+		}
+		if best == "" {
+			continue
+		}
+		ls.Fields[f] = best
+		confidence[f] = bestScore
+		if f == parser.Date {
+			ls.DateFormat = layout
+		}
+	}
+	if ls.Fields[parser.Date] == "" && ls.Fields[parser.Level] == "" && ls.Fields[parser.Message] == "" {
+		return false
+	}
+	res.LogStructure, res.Confidence = ls, confidence
+	return true
+}
+
+func isKeyOf(key string, field string) bool {
+	k := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	for _, c := range detectKeys[field] {
+		if k == c {
+			return true
+		}
+	}
+	return false
+}
+
+//detectDelimited detects delimiter with most records of the same number of tokens and
+//classifies their columns, last column holds the rest of line
+func detectDelimited(lines []string, res *model.DetectResponse) bool {
+	delim, columns, score := "", 0, 0.0
+	for _, d := range []string{"|", "\t", ";", ","} {
+		counts := make(map[int]int)
+		for _, l := range lines {
+			counts[strings.Count(l, d)+1]++
+		}
+		mode := 0
+		for n, c := range counts {
+			if n >= 3 && (c > counts[mode] || (c == counts[mode] && n < mode)) {
+				mode = n
+			}
+		}
+		if mode == 0 {
+			continue
+		}
+		structured := 0
+		for n, c := range counts {
+			if n >= mode {
+				structured += c
+			}
+		}
+		if s := float64(structured) / float64(len(lines)); s > score {
+			delim, columns, score = d, mode, s
+		}
+	}
+	//records with stack traces have more continuation lines than records
+	if delim == "" || score < detectMinScore/2 {
+		return false
+	}
+	cols := make([][]string, columns)
+	for _, l := range lines {
+		tokens := strings.SplitN(l, delim, columns)
+		if len(tokens) < columns {
+			continue
+		}
+		for i, t := range tokens {
+			cols[i] = append(cols[i], strings.TrimSpace(t))
+		}
+	}
+	ls := &model.LogStructure{Date: -1, Level: -1, User: -1, Reqid: -1, Message: -1}
+	if delim != "|" {
+		ls.Delimiter = delim
+	}
+	res.LogStructure, res.Confidence["format"] = ls, score
+	taken := make(map[int]bool)
+	pick := func(field string, score func(values []string) float64, last bool) int {
+		best, bestScore := -1, detectMinScore
+		for i, values := range cols {
+			if taken[i] {
+				continue
+			}
+			if s := score(values); s > bestScore || (s == bestScore && best >= 0 && last) {
+				best, bestScore = i, s
+			}
+		}
+		if best >= 0 {
+			taken[best] = true
+			res.Confidence[field] = bestScore
+		}
+		return best
+	}
+	ls.Date = pick(parser.Date, func(values []string) float64 {
+		_, s := dateScore(values)
+		return s
+	}, false)
+	if ls.Date >= 0 {
+		ls.DateFormat, _ = dateScore(cols[ls.Date])
+	}
+	ls.Level = pick(parser.Level, levelScore, false)
+	ls.Message = pick(parser.Message, func(values []string) float64 {
+		return fraction(values, func(v string) bool { return strings.Contains(v, " ") })
+	}, true)
+	ls.Reqid = pick(parser.ReqID, func(values []string) float64 {
+		return fraction(values, func(v string) bool {
+			return reqidLike.MatchString(v) && hasDigit.MatchString(v) && !threadLike.MatchString(v) && !classLike.MatchString(v)
+		})
+	}, false)
+	ls.User = pick(parser.User, func(values []string) float64 {
+		nonEmpty := make([]string, 0, len(values))
+		for _, v := range values {
+			if v != "" {
+				nonEmpty = append(nonEmpty, v)
+			}
+		}
+		if len(nonEmpty) < len(values)/3 {
+			return 0
+		}
+		return fraction(nonEmpty, func(v string) bool {
+			return userLike.MatchString(v) && !threadLike.MatchString(v) && !classLike.MatchString(v) && !detectLevels[strings.ToUpper(v)]
+		})
+	}, false)
+	return true
+}
+
+//detectPadded detects white space padded log starting with date, level follows it within few
+//tokens, the rest is message
+func detectPadded(lines []string, res *model.DetectResponse) bool {
+	tokens := make([][]string, len(lines))
+	for i, l := range lines {
+		tokens[i] = strings.Fields(l)
+	}
+	column := func(from int, n int) []string {
+		values := make([]string, 0, len(tokens))
+		for _, t := range tokens {
+			if len(t) >= from+n {
+				values = append(values, strings.Join(t[from:from+n], " "))
+			}
+		}
+		return values
+	}
+	dateTokens, layout, dateScr := 0, "", 0.0
+	for n := 2; n >= 1; n-- {
+		if l, s := dateScore(column(0, n)); s > dateScr+0.1 {
+			dateTokens, layout, dateScr = n, l, s
+		}
+	}
+	if dateScr < detectMinScore/2 {
+		return false
+	}
+	pattern := `^(?P<date>\S+)`
+	if dateTokens == 2 {
+		pattern = `^(?P<date>\S+\s+\S+)`
+	}
+	for i := dateTokens; i < dateTokens+4; i++ {
+		if levelScore(column(i, 1)) >= detectMinScore {
+			pattern += strings.Repeat(`\s+\S+`, i-dateTokens) + `\s+(?P<level>\S+)`
+			break
+		}
+	}
+	pattern += `\s+(?P<message>.*)$`
+	ls := &model.LogStructure{Format: model.FormatRegex, Pattern: pattern, DateFormat: layout}
+	p, err := parser.New(ls)
+	if err != nil {
+		return false
+	}
+	var dates, levels, matched []string
+	for _, l := range lines {
+		if rec, ok := p.Parse(l); ok {
+			dates, levels = append(dates, rec.Date), append(levels, rec.Level)
+			matched = append(matched, l)
+		}
+	}
+	res.LogStructure = ls
+	res.Confidence["format"] = float64(len(matched)) / float64(len(lines))
+	_, res.Confidence[parser.Date] = dateScore(dates)
+	if strings.Contains(pattern, "?P<level>") {
+		res.Confidence[parser.Level] = levelScore(levels)
+	}
+	res.Confidence[parser.Message] = res.Confidence["format"]
+	return true
+}
+
+//dateScore best layout and share of values it parses, layout has to format parsed value back
+//as parsing accepts fractional seconds the layout does not have
+func dateScore(values []string) (string, float64) {
+	best, score := "", 0.0
+	for _, l := range detectLayouts {
+		if s := fraction(values, func(v string) bool {
+			t, err := parseTime(l, v)
+			return err == nil && t.Format(l) == v
+		}); s > score {
+			best, score = l, s
+		}
+	}
+	return best, score
+}
+
+func levelScore(values []string) float64 {
+	return fraction(values, func(v string) bool { return detectLevels[strings.ToUpper(v)] })
+}
+
+func fraction(values []string, fn func(string) bool) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	n := 0
+	for _, v := range values {
+		if fn(v) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(values))
+}
@@ -0,0 +1,18 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package search
+
+import "os"
+
+//fileKey is not available, rotation is detected by size shrink only
+type fileKey struct{}
+
+//String empty as file identity is not known
+func (k fileKey) String() string {
+	return ""
+}
+
+func fileID(info os.FileInfo) fileKey {
+	return fileKey{}
+}
@@ -0,0 +1,31 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package search
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+//fileKey device and inode of file, file replaced by rotation has different key
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+//String device and inode in hex
+func (k fileKey) String() string {
+	if k == (fileKey{}) {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x", k.dev, k.ino)
+}
+
+func fileID(info os.FileInfo) fileKey {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	}
+	return fileKey{}
+}
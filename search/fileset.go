@@ -0,0 +1,137 @@
+package search
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//LogFiles files to read for log, with history the whole rotation chain
+func LogFiles(log string, history bool) ([]string, error) {
+	if !history {
+		return []string{log}, nil
+	}
+	return RotationChain(log)
+}
+
+//RotationChain expands log into its rotation chain (app.log.1, app-2021-05-06.log.gz, ...)
+//in chronological order, log itself is last
+func RotationChain(log string) ([]string, error) {
+	dir := filepath.Dir(log)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open dir %v, %v", dir, err)
+	}
+	base := filepath.Base(log)
+	rotated := make([]os.FileInfo, 0, 4)
+	for _, f := range files {
+		if !f.IsDir() && f.Name() != base && isRotation(base, f.Name()) {
+			rotated = append(rotated, f)
+		}
+	}
+	sort.SliceStable(rotated, func(i int, j int) bool {
+		if rotated[i].ModTime().Equal(rotated[j].ModTime()) {
+			return rotated[i].Name() > rotated[j].Name()
+		}
+		return rotated[i].ModTime().Before(rotated[j].ModTime())
+	})
+	out := make([]string, 0, len(rotated)+1)
+	for _, f := range rotated {
+		out = append(out, filepath.Join(dir, f.Name()))
+	}
+	if _, err := os.Stat(log); err == nil {
+		out = append(out, log)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("Could not find %v or its rotations", log)
+	}
+	return out, nil
+}
+
+//isRotation true for app.log.1, app.log.gz, app-2021-05-06.log, app.1.log.gz when base is app.log,
+//rotation is suffixed by number or date, not by app.log.bak or app.log.lock
+func isRotation(base string, name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	if name == base {
+		return true
+	}
+	if strings.HasPrefix(name, base+".") {
+		return isRotationSuffix(name[len(base)+1:])
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if len(name) < len(stem)+len(ext)+2 || !strings.HasPrefix(name, stem) || !strings.HasSuffix(name, ext) {
+		return false
+	}
+	rest := name[len(stem) : len(name)-len(ext)]
+	return strings.ContainsRune("-_.", rune(rest[0])) && isRotationSuffix(rest[1:])
+}
+
+//isRotationSuffix true for number or date like 1, 20210506, 2021-05-06_1
+func isRotationSuffix(s string) bool {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && !strings.ContainsRune("-_.", r) {
+			return false
+		}
+	}
+	return true
+}
+
+//IsCompressed true for gzip rotations
+func IsCompressed(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
+
+//OpenLog opens log file, gzip files are transparently decompressed
+func OpenLog(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !IsCompressed(path) {
+		return f, nil
+	}
+	cr := &countingReader{r: f}
+	gz, err := gzip.NewReader(bufio.NewReader(cr))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not decompress %v, %v", path, err)
+	}
+	return &gzipFile{Reader: gz, file: f, counter: cr}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file    *os.File
+	counter *countingReader
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+//Consumed compressed bytes read from file
+func (g *gzipFile) Consumed() int64 {
+	return g.counter.n
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,174 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//tailMatcher matcher of tail filter, nil without filter, with log structure value is matched
+//against message of record
+func tailMatcher(req *model.LogRequest) (Matcher, error) {
+	tf := req.Filter
+	if tf == nil || (tf.Value == "" && tf.Level == "" && tf.User == "" && tf.ReqID == "") {
+		return nil, nil
+	}
+	var m Matcher
+	if tf.Value != "" {
+		var err error
+		if m, err = NewMatcher(tf.Value, tf.Mode, tf.CaseSensitive); err != nil {
+			return nil, err
+		}
+	}
+	if req.LogStructure == nil {
+		if tf.Level != "" || tf.User != "" || tf.ReqID != "" {
+			return nil, fmt.Errorf("Filter by level, user or reqid needs log structure")
+		}
+		return m, nil
+	}
+	p, err := parser.Of(req.LogStructure)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldFilter{p: p, level: tf.Level, user: tf.User, reqid: tf.ReqID,
+		caseSensitive: tf.CaseSensitive, message: m}, nil
+}
+
+//fieldFilter matches records by level, user and reqid and by message
+type fieldFilter struct {
+	p             parser.Parser
+	level         string
+	user          string
+	reqid         string
+	caseSensitive bool
+	message       Matcher
+}
+
+//Match matches record, records without log structure match only filter of message by whole text
+func (f *fieldFilter) Match(rec string) bool {
+	r, ok := f.p.Parse(rec)
+	if !ok {
+		return f.level == "" && f.user == "" && f.reqid == "" && f.message.Match(rec)
+	}
+	if f.level != "" && !strings.EqualFold(f.level, NormalizeText(r.Level)) {
+		return false
+	}
+	if f.user != "" && !f.equal(f.user, r.User) {
+		return false
+	}
+	if f.reqid != "" && !f.equal(f.reqid, r.ReqID) {
+		return false
+	}
+	return f.message == nil || f.message.Match(r.Message)
+}
+
+//Find highlights matches of message filter in message of line, lines without structure of log
+//are matched whole like in Match
+func (f *fieldFilter) Find(line string) [][]int {
+	if f.message == nil {
+		return nil
+	}
+	r, ok := f.p.Parse(line)
+	if !ok {
+		return f.message.Find(line)
+	}
+	msg := r.Message
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	//message is searched from the end as it usually follows other fields
+	start := strings.LastIndex(line, msg)
+	if msg == "" || start < 0 {
+		return nil
+	}
+	found := f.message.Find(msg)
+	for _, m := range found {
+		for i := range m {
+			m[i] += start
+		}
+	}
+	return found
+}
+
+func (f *fieldFilter) equal(value string, field string) bool {
+	if f.caseSensitive {
+		return value == field
+	}
+	return strings.EqualFold(value, field)
+}
+
+//recordFilter filters lines by records they belong to, continuation lines are kept with first line
+//of their record, decision about last record carries over to lines read next
+type recordFilter struct {
+	m     Matcher
+	start *regexp.Regexp
+	keep  bool
+}
+
+//newRecordFilter filter of tail request, without log structure every line is record
+func newRecordFilter(req *model.LogRequest) (*recordFilter, error) {
+	m, err := tailMatcher(req)
+	if err != nil {
+		return nil, err
+	}
+	start, err := recordStart(req.LogStructure)
+	if err != nil {
+		return nil, err
+	}
+	return &recordFilter{m: m, start: start}, nil
+}
+
+//appendLines appends non empty lines of text of records matching filter with their highlights
+//to response
+func (f *recordFilter) appendLines(res *model.TailLogResponse, text string) {
+	if f.m == nil {
+		for _, l := range strings.Split(text, "\n") {
+			if l = NormalizeText(l); strings.TrimSpace(l) != "" {
+				res.Lines = append(res.Lines, l)
+				if f.start == nil || f.start.MatchString(l) {
+					res.Records++
+				}
+			}
+		}
+		return
+	}
+	rec := make([]string, 0, 1)
+	for _, l := range strings.Split(text, "\n") {
+		l = NormalizeText(l)
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if f.start == nil || f.start.MatchString(l) {
+			f.flush(res, rec, true)
+			rec = rec[:0]
+		} else if len(rec) == 0 {
+			//continuation of record from previous text
+			f.flush(res, []string{l}, false)
+			continue
+		}
+		rec = append(rec, l)
+	}
+	f.flush(res, rec, true)
+}
+
+func (f *recordFilter) flush(res *model.TailLogResponse, rec []string, match bool) {
+	if len(rec) == 0 {
+		return
+	}
+	if match {
+		f.keep = f.m.Match(strings.Join(rec, "\n"))
+	}
+	if !f.keep {
+		return
+	}
+	if match {
+		res.Records++
+	}
+	for _, l := range rec {
+		res.Lines = append(res.Lines, l)
+		res.Highlights = append(res.Highlights, Highlights(l, f.m.Find(l)))
+	}
+}
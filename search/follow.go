@@ -0,0 +1,214 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//followMaxBytes max bytes read by single Next, the rest is read by following calls
+var followMaxBytes int64 = 1024 * 1024
+
+//Follower follows log for single subscriber, every Next returns only complete lines appended
+//since previous read
+type Follower struct {
+	req    *model.LogRequest
+	filter *recordFilter
+	offset int64
+	id     fileKey
+	//file of id, replaced file is read to its end through it after rotation
+	file *os.File
+}
+
+//NewFollower tails log and returns follower continuing after last tailed line
+func NewFollower(req *model.LogRequest) (*Follower, *model.TailLogResponse, error) {
+	filter, err := newRecordFilter(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(req.Log)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not open file %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("Could not stat file %v", err)
+	}
+	res, _, err := tailLog(req, 0, true)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return &Follower{req: req, filter: filter, offset: res.Offset, id: fileID(info), file: file}, res, nil
+}
+
+//NewFollowerAtEnd follower of lines appended to log from now on
+func NewFollowerAtEnd(req *model.LogRequest) (*Follower, error) {
+	filter, err := newRecordFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	f, err := followEnd(req.Log)
+	if err != nil {
+		return nil, err
+	}
+	f.req, f.filter = req, filter
+	return f, nil
+}
+
+//Close closes followed file
+func (f *Follower) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+//Offset in log after last line read
+func (f *Follower) Offset() int64 {
+	return f.offset
+}
+
+//Next lines appended since previous read, nil when there are none, after rotation lines appended
+//to replaced file are read first, then lines from start of log with rotated event, after
+//truncation lines are read from start of log with truncated event
+func (f *Follower) Next() (*model.TailLogResponse, error) {
+	start := time.Now()
+	c, err := f.read()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	res := &model.TailLogResponse{
+		Lines:   make([]string, 0, 10),
+		LogFile: f.req.Log,
+		ModTime: c.modTime,
+		Offset:  c.end,
+		Event:   c.event,
+	}
+	f.filter.appendLines(res, c.data)
+	res.Time = time.Now().Sub(start).Milliseconds()
+	return res, nil
+}
+
+//chunk complete lines appended to log, [start, end) in file of id, event is set when file was replaced
+type chunk struct {
+	seq     int64
+	gen     int
+	id      fileKey
+	start   int64
+	end     int64
+	data    string
+	event   string
+	modTime int64
+}
+
+//read reads complete lines appended since previous read, nil when there are none
+func (f *Follower) read() (*chunk, error) {
+	file, err := os.Open(f.req.Log)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open file %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Could not stat file %v", err)
+	}
+	if id := fileID(info); id != f.id {
+		//lines appended to replaced file before rotation go first
+		if c, err := f.drain(); err != nil || c != nil {
+			file.Close()
+			return c, err
+		}
+		f.Close()
+		f.file, f.id, f.offset = file, id, 0
+		return f.next(file, info, model.TailEventRotated, false)
+	}
+	defer file.Close()
+	event := ""
+	if info.Size() < f.offset {
+		event = model.TailEventTruncated
+		f.offset = 0
+	}
+	return f.next(file, info, event, false)
+}
+
+//drain reads lines of replaced file left after previous read, nil when it was read to its end
+func (f *Follower) drain() (*chunk, error) {
+	if f.file == nil {
+		return nil, nil
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Could not stat file %v", err)
+	}
+	if info.Size() <= f.offset {
+		return nil, nil
+	}
+	return f.next(f.file, info, "", true)
+}
+
+//next reads lines of file from offset, last line of replaced file is read even when it has no
+//
+//line end as nothing is appended to it anymore
+func (f *Follower) next(file *os.File, info os.FileInfo, event string, replaced bool) (*chunk, error) {
+	n := info.Size() - f.offset
+	if n > followMaxBytes {
+		n = followMaxBytes
+	}
+	data := make([]byte, n)
+	if _, err := file.ReadAt(data, f.offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Could not read %v, %v", f.req.Log, err)
+	}
+	complete := completeLines(data)
+	if complete == 0 && n == followMaxBytes || replaced && f.offset+n == info.Size() {
+		//line longer than read limit is sent in parts, last line of replaced file is complete
+		complete = len(data)
+	}
+	if complete == 0 && event == "" {
+		return nil, nil
+	}
+	c := &chunk{id: f.id, start: f.offset, end: f.offset + int64(complete), data: string(data[:complete]),
+		event: event, modTime: info.ModTime().Unix()}
+	f.offset = c.end
+	return c, nil
+}
+
+//followEnd follower of log positioned after its last complete line
+func followEnd(log string) (*Follower, error) {
+	file, err := os.Open(log)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open file %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Could not stat file %v", err)
+	}
+	end := info.Size()
+	if end > 0 {
+		if end, err = lineStart(file, end); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Could not read %v, %v", log, err)
+		}
+	}
+	return &Follower{req: &model.LogRequest{Log: log}, offset: end, id: fileID(info), file: file}, nil
+}
+
+//readRange reads [start, end) of file
+func readRange(path string, start int64, end int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data := make([]byte, end-start)
+	n, err := file.ReadAt(data, start)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(data[:n]), nil
+}
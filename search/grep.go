@@ -0,0 +1,221 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//grepJob greps single log over its files passing matches to onMatch and, when set, scanned bytes to onProgress
+type grepJob struct {
+	ctx        context.Context
+	log        string
+	m          Matcher
+	req        *model.GrepRequest
+	found      int
+	onMatch    func(model.GrepMatch) error
+	onProgress func(scanned int64, total int64) error
+}
+
+func (j *grepJob) limitReached() bool {
+	return j.req.MaxResults > 0 && j.found >= j.req.MaxResults
+}
+
+//run greps log, returns encoded cursor when stopped at max results
+func (j *grepJob) run() (string, error) {
+	files, err := LogFiles(j.log, j.req.History)
+	if err != nil {
+		return "", err
+	}
+	if j.req.Reverse {
+		for a, b := 0, len(files)-1; a < b; a, b = a+1, b-1 {
+			files[a], files[b] = files[b], files[a]
+		}
+	}
+	start, err := findCursor(j.req.Cursors, j.log)
+	if err != nil {
+		return "", err
+	}
+	if start != nil && start.Reverse != j.req.Reverse {
+		return "", fmt.Errorf("Cursor direction does not match reverse %v of request", j.req.Reverse)
+	}
+	if start != nil {
+		i := indexOf(files, start.File)
+		if i < 0 {
+			return "", fmt.Errorf("Cursor file %v does not exist anymore", start.File)
+		}
+		files = files[i:]
+	}
+	var total, done int64
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			total += info.Size()
+		}
+	}
+	for i, f := range files {
+		if j.limitReached() {
+			return cursor{Log: j.log, File: f, LineNumber: 1, Reverse: j.req.Reverse}.encode(), nil
+		}
+		var from *cursor
+		if i == 0 {
+			from = start
+		}
+		var progress func(int64) error
+		if j.onProgress != nil {
+			progress = func(scanned int64) error {
+				return j.onProgress(done+scanned, total)
+			}
+		}
+		scanned, stop, err := j.file(f, from, progress)
+		if err != nil {
+			return "", fmt.Errorf("Could not grep %v, %v", f, err)
+		}
+		if stop != nil {
+			return stop.encode(), nil
+		}
+		done += scanned
+	}
+	return "", nil
+}
+
+//file greps single file from cursor, returns bytes scanned and cursor when stopped at max results
+func (j *grepJob) file(path string, from *cursor, onProgress func(scanned int64) error) (int64, *cursor, error) {
+	if positions, end, ok := j.lookup(path); ok {
+		rest, stop, err := j.indexed(path, positions, end, from)
+		if err != nil || stop != nil {
+			return 0, stop, err
+		}
+		from = rest
+	}
+	scanner, f, err := j.open(path, from)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	emit := func(match model.GrepMatch) error {
+		return j.emit(path, match)
+	}
+	cc := newContextCollector(j.req.Before, j.req.After)
+	if j.req.Reverse {
+		cc = newContextCollector(j.req.After, j.req.Before)
+	}
+	var reported int64
+	//next offset of record read before current one, end of unread part in reverse mode
+	var next int64
+	for scanner.Scan() {
+		select {
+		case <-j.ctx.Done():
+			return scanner.Scanned(), nil, j.ctx.Err()
+		default:
+		}
+		rec := scanner.Record()
+		matched := j.m.Match(rec.Text)
+		if j.limitReached() && (matched || !cc.waiting()) {
+			stop := &cursor{Log: j.log, File: path, Offset: rec.Offset, LineNumber: rec.LineNumber, Reverse: j.req.Reverse}
+			if j.req.Reverse {
+				stop.Offset = next
+			}
+			return scanner.Scanned(), stop, emitAll(emit, cc.flush())
+		}
+		next = rec.Offset
+		if matched {
+			j.found++
+		}
+		line := model.GrepLine{LineNumber: rec.LineNumber, Offset: rec.Offset, Line: NormalizeText(rec.Text)}
+		if err := emitAll(emit, cc.add(line, matched)); err != nil {
+			return scanner.Scanned(), nil, err
+		}
+		if onProgress != nil && scanner.Scanned()-reported >= progressStep {
+			reported = scanner.Scanned()
+			if err := onProgress(reported); err != nil {
+				return reported, nil, err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return scanner.Scanned(), nil, err
+	}
+	if err := emitAll(emit, cc.flush()); err != nil {
+		return scanner.Scanned(), nil, err
+	}
+	if onProgress != nil {
+		if err := onProgress(scanner.Scanned()); err != nil {
+			return scanner.Scanned(), nil, err
+		}
+	}
+	return scanner.Scanned(), nil, nil
+}
+
+//emit passes match found in file to onMatch
+func (j *grepJob) emit(path string, match model.GrepMatch) error {
+	match.Highlights = Highlights(match.Line, j.m.Find(match.Line))
+	if j.req.Reverse {
+		//context was collected in reading order
+		match.Before, match.After = reverseLines(match.After), reverseLines(match.Before)
+	}
+	if path != j.log {
+		setFile(&match, path)
+	}
+	return j.onMatch(match)
+}
+
+//recordSource forward or reverse record scanner
+type recordSource interface {
+	Scan() bool
+	Record() *Record
+	Err() error
+	Scanned() int64
+}
+
+func (j *grepJob) open(path string, from *cursor) (recordSource, io.Closer, error) {
+	tr := NewTimeRange(j.req.FromTime, j.req.ToTime)
+	if j.req.Reverse {
+		var end int64
+		if from != nil {
+			end = from.Offset
+		}
+		return OpenReverseRecords(path, j.req.LogStructure, tr, end)
+	}
+	if from != nil {
+		return openRecords(path, j.req.LogStructure, tr, from.Offset, from.LineNumber)
+	}
+	return OpenRecords(path, j.req.LogStructure, tr)
+}
+
+func reverseLines(lines []model.GrepLine) []model.GrepLine {
+	for a, b := 0, len(lines)-1; a < b; a, b = a+1, b-1 {
+		lines[a], lines[b] = lines[b], lines[a]
+	}
+	return lines
+}
+
+func emitAll(emit func(model.GrepMatch) error, matches []model.GrepMatch) error {
+	for _, m := range matches {
+		if err := emit(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFile(m *model.GrepMatch, file string) {
+	m.File = file
+	for j := range m.Before {
+		m.Before[j].File = file
+	}
+	for j := range m.After {
+		m.After[j].File = file
+	}
+}
+
+func indexOf(values []string, v string) int {
+	for i, s := range values {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,313 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//feedCacheChunks chunks kept by feed, subscribers further behind read from disk
+var feedCacheChunks = 64
+
+//Hub shares single watcher and reader of followed log among all its subscribers
+type Hub struct {
+	mu     sync.Mutex
+	feeds  map[string]*feed
+	logger l.Logger
+}
+
+//NewHub new hub
+func NewHub(logger l.Logger) *Hub {
+	return &Hub{feeds: make(map[string]*feed), logger: logger}
+}
+
+//feed reads lines appended to log when watcher signals change and caches them for subscribers,
+//gen is incremented when log is rotated or truncated
+type feed struct {
+	log      string
+	follower *Follower
+	w        watcher
+	mu       sync.Mutex
+	chunks   []*chunk
+	seq      int64
+	gen      int
+	subs     map[*Subscription]bool
+	done     chan struct{}
+}
+
+//Subscription lines appended to log, filtered by subscriber request
+type Subscription struct {
+	hub    *Hub
+	feed   *feed
+	req    *model.LogRequest
+	filter *recordFilter
+	wake   chan struct{}
+	seq    int64
+	gen    int
+	id     fileKey
+	offset int64
+	//backlog end of lines written before subscribing still to be read from disk
+	backlog int64
+}
+
+//Subscribe tails log and subscribes to lines appended to it
+func (h *Hub) Subscribe(ctx context.Context, req *model.LogRequest) (*Subscription, *model.TailLogResponse, error) {
+	s, err := h.subscribe(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(req.Log)
+	if err != nil {
+		s.Close()
+		return nil, nil, fmt.Errorf("Could not stat file %v", err)
+	}
+	s.id = fileID(info)
+	res, _, err := tailLog(req, 0, true)
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+	s.offset = res.Offset
+	return s, res, nil
+}
+
+//Resume subscribes to lines of log from offset in file on, lines already written are read from
+//disk first, log is read from start when file is not the current file of log (rotated) or offset
+//is beyond its end (truncated), empty file is not checked
+func (h *Hub) Resume(ctx context.Context, req *model.LogRequest, file string, offset int64) (*Subscription, *model.TailLogResponse, error) {
+	s, err := h.subscribe(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := followEnd(req.Log)
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+	end.Close()
+	res := &model.TailLogResponse{Lines: make([]string, 0, 10), LogFile: req.Log}
+	s.id = end.id
+	switch {
+	case file != "" && file != end.id.String():
+		res.Event = model.TailEventRotated
+		offset = 0
+	case offset > end.offset:
+		res.Event = model.TailEventTruncated
+		offset = 0
+	}
+	s.offset, s.backlog = offset, end.offset
+	if err = s.catchUp(res); err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+	return s, res, nil
+}
+
+//subscribe registers subscriber of feed of log, starting the feed for first subscriber
+func (h *Hub) subscribe(ctx context.Context, req *model.LogRequest) (*Subscription, error) {
+	filter, err := newRecordFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.feeds[req.Log]
+	if !ok {
+		if f, err = h.start(ctx, req.Log); err != nil {
+			return nil, err
+		}
+	}
+	s := &Subscription{hub: h, feed: f, req: req, filter: filter, wake: make(chan struct{}, 1)}
+	f.mu.Lock()
+	f.subs[s] = true
+	s.seq, s.gen = f.seq, f.gen
+	f.mu.Unlock()
+	return s, nil
+}
+
+//start starts feed of log, hub lock is held
+func (h *Hub) start(ctx context.Context, log string) (*feed, error) {
+	follower, err := followEnd(log)
+	if err != nil {
+		return nil, err
+	}
+	f := &feed{log: log, follower: follower, w: newWatcher(log), subs: make(map[*Subscription]bool),
+		done: make(chan struct{})}
+	h.feeds[log] = f
+	go f.run(ctx, h.logger)
+	return f, nil
+}
+
+func (f *feed) run(ctx context.Context, logger l.Logger) {
+	defer close(f.done)
+	for range f.w.events() {
+		for {
+			c, err := f.follower.read()
+			if err != nil {
+				//log is missing for a moment while being rotated
+				logger.Info(ctx, "Could not read %v, %v", f.log, err)
+				break
+			}
+			if c == nil {
+				break
+			}
+			f.add(c)
+		}
+	}
+}
+
+func (f *feed) add(c *chunk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c.event != "" {
+		f.gen++
+	}
+	f.seq++
+	c.seq, c.gen = f.seq, f.gen
+	f.chunks = append(f.chunks, c)
+	if len(f.chunks) > feedCacheChunks {
+		f.chunks = f.chunks[len(f.chunks)-feedCacheChunks:]
+	}
+	for s := range f.subs {
+		notify(s.wake)
+	}
+}
+
+//since chunks added after seq
+func (f *feed) since(seq int64) []*chunk {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, c := range f.chunks {
+		if c.seq > seq {
+			return append([]*chunk(nil), f.chunks[i:]...)
+		}
+	}
+	return nil
+}
+
+//Next waits for lines appended to log matching subscriber filter
+func (s *Subscription) Next(ctx context.Context) (*model.TailLogResponse, error) {
+	for {
+		res, err := s.collect()
+		if err != nil || res != nil {
+			return res, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.wake:
+		}
+	}
+}
+
+//collect lines not consumed yet, subscriber behind cached chunks catches up from disk in parts
+//of at most followMaxBytes
+func (s *Subscription) collect() (*model.TailLogResponse, error) {
+	start := time.Now()
+	res := &model.TailLogResponse{Lines: make([]string, 0, 10), LogFile: s.req.Log}
+	for {
+		if err := s.catchUp(res); err != nil {
+			return nil, err
+		}
+		if len(res.Lines) > 0 || !s.follow(res) {
+			break
+		}
+	}
+	if len(res.Lines) == 0 && res.Event == "" {
+		return nil, nil
+	}
+	res.Offset = s.offset
+	res.Time = time.Now().Sub(start).Milliseconds()
+	return res, nil
+}
+
+//follow appends lines of cached chunks, returns true when it stopped before gap between
+//subscriber offset and next chunk or before lines of replaced log
+func (s *Subscription) follow(res *model.TailLogResponse) bool {
+	var sb strings.Builder
+	more := false
+	for _, c := range s.feed.since(s.seq) {
+		if c.gen != s.gen {
+			if sb.Len() > 0 || len(res.Lines) > 0 {
+				//lines of replaced log go first
+				more = true
+				break
+			}
+			res.Event = model.TailEventRotated
+			if c.event != "" {
+				res.Event = c.event
+			}
+			s.gen, s.id, s.offset, s.backlog = c.gen, c.id, 0, 0
+		}
+		if s.offset < c.start {
+			s.backlog, more = c.start, true
+			break
+		}
+		if s.offset < c.end {
+			sb.WriteString(c.data[s.offset-c.start:])
+			s.offset = c.end
+		}
+		s.seq, res.ModTime = c.seq, c.modTime
+	}
+	s.filter.appendLines(res, sb.String())
+	return more
+}
+
+//catchUp reads backlog from disk in parts of at most followMaxBytes until lines matching filter
+//are found or backlog is read
+func (s *Subscription) catchUp(res *model.TailLogResponse) error {
+	for s.offset < s.backlog && len(res.Lines) == 0 {
+		end := s.backlog
+		if end-s.offset > followMaxBytes {
+			end = s.offset + followMaxBytes
+		}
+		text, err := readRange(s.feed.log, s.offset, end)
+		if err != nil {
+			return fmt.Errorf("Could not read %v, %v", s.feed.log, err)
+		}
+		if n := completeLines([]byte(text)); n > 0 && end < s.backlog {
+			text = text[:n]
+		}
+		s.offset += int64(len(text))
+		if len(text) == 0 {
+			//log was truncated meanwhile, feed reports it
+			s.backlog = s.offset
+		}
+		s.filter.appendLines(res, text)
+	}
+	res.Offset = s.offset
+	return nil
+}
+
+//Offset in log after last line read
+func (s *Subscription) Offset() int64 {
+	return s.offset
+}
+
+//File identity of file of log lines were read from, empty when platform does not have it
+func (s *Subscription) File() string {
+	return s.id.String()
+}
+
+//Close unsubscribes, feed of log stops with its last subscriber
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	f := s.feed
+	f.mu.Lock()
+	delete(f.subs, s)
+	last := len(f.subs) == 0
+	f.mu.Unlock()
+	if last && s.hub.feeds[f.log] == f {
+		delete(s.hub.feeds, f.log)
+		f.w.close()
+		<-f.done
+		f.follower.Close()
+	}
+}
@@ -0,0 +1,205 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//Position offset and line number of record start
+type Position struct {
+	Offset     int64
+	LineNumber int
+}
+
+//Index answers exact field lookups without scanning the file
+type Index interface {
+	//Lookup positions of records of file with field equal to lower cased value and position
+	//where indexed part of file ends, ok is false when file is not indexed for field or changed
+	Lookup(file string, field string, value string) (positions []Position, end Position, ok bool)
+}
+
+var index Index
+
+//UseIndex sets index used by Grep for field lookups, nil disables it
+func UseIndex(ix Index) {
+	index = ix
+}
+
+//OpenRecordsAt opens log for reading records from position without time range
+func OpenRecordsAt(path string, ls *model.LogStructure, p Position) (*RecordScanner, io.Closer, error) {
+	return openRecords(path, ls, TimeRange{}, p.Offset, p.LineNumber)
+}
+
+//FieldValues values of field in first line of record, reqid and user need parser of log structure
+func FieldValues(line string, field string, p parser.Parser) []string {
+	switch field {
+	case model.FieldReqID, model.FieldUser:
+		if p == nil {
+			return nil
+		}
+		rec, ok := p.Parse(line)
+		if !ok {
+			return nil
+		}
+		v := rec.ReqID
+		if field == model.FieldUser {
+			v = rec.User
+		}
+		if v != "" {
+			return []string{v}
+		}
+		return nil
+	case model.FieldToken:
+		return strings.FieldsFunc(line, isTokenSeparator)
+	}
+	return nil
+}
+
+func isTokenSeparator(r rune) bool {
+	return r == '|' || unicode.IsSpace(r)
+}
+
+//fieldMatcher matches records with field equal to value
+type fieldMatcher struct {
+	field         string
+	value         string
+	caseSensitive bool
+	p             parser.Parser
+	re            *regexp.Regexp
+}
+
+func newFieldMatcher(req *model.GrepRequest) (*fieldMatcher, error) {
+	switch req.Field {
+	case model.FieldReqID, model.FieldUser:
+		if req.LogStructure == nil {
+			return nil, fmt.Errorf("Field '%v' requires log structure", req.Field)
+		}
+	case model.FieldToken:
+	default:
+		return nil, fmt.Errorf("Invalid field '%v', expected %v, %v or %v", req.Field, model.FieldReqID, model.FieldUser, model.FieldToken)
+	}
+	value := strings.TrimSpace(req.Value)
+	if value == "" {
+		return nil, fmt.Errorf("Missing value for field '%v'", req.Field)
+	}
+	p, err := recordParser(req.LogStructure)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldMatcher{field: req.Field, value: value, caseSensitive: req.CaseSensitive, p: p,
+		re: literalRegex(value, req.CaseSensitive)}, nil
+}
+
+func (m fieldMatcher) Match(line string) bool {
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	for _, v := range FieldValues(line, m.field, m.p) {
+		if v == m.value || (!m.caseSensitive && strings.EqualFold(v, m.value)) {
+			return true
+		}
+	}
+	return false
+}
+
+//Find highlights whole value occurrences bounded by delimiters or spaces
+func (m fieldMatcher) Find(line string) [][]int {
+	out := make([][]int, 0, 1)
+	for _, loc := range m.re.FindAllStringIndex(line, -1) {
+		if loc[0] > 0 && !isTokenSeparator(rune(line[loc[0]-1])) {
+			continue
+		}
+		if loc[1] < len(line) && !isTokenSeparator(rune(line[loc[1]])) {
+			continue
+		}
+		out = append(out, loc)
+	}
+	return out
+}
+
+//newRequestMatcher matcher for grep request, field lookup or query in request mode
+func newRequestMatcher(req *model.GrepRequest) (Matcher, error) {
+	if req.Field != "" {
+		return newFieldMatcher(req)
+	}
+	return NewMatcher(req.Value, req.Mode, req.CaseSensitive)
+}
+
+//lookup positions of matching records from index, only for field lookups without context
+func (j *grepJob) lookup(path string) ([]Position, Position, bool) {
+	if index == nil || j.req.Field == "" || j.req.Reverse || j.req.Before > 0 || j.req.After > 0 {
+		return nil, Position{}, false
+	}
+	return index.Lookup(path, j.req.Field, strings.ToLower(strings.TrimSpace(j.req.Value)))
+}
+
+//indexed greps records at indexed positions from cursor, returns cursor where scanning of
+//unindexed rest of file starts or stop cursor when max results was reached
+func (j *grepJob) indexed(path string, positions []Position, end Position, from *cursor) (*cursor, *cursor, error) {
+	ls := j.req.LogStructure
+	tr := NewTimeRange(j.req.FromTime, j.req.ToTime)
+	if tr.IsSet() && DateLayout(ls) == "" {
+		return nil, nil, fmt.Errorf("Time range requires log structure with date format")
+	}
+	if from != nil && from.Offset >= end.Offset {
+		return from, nil, nil
+	}
+	r, size, closer, err := openReaderAt(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closer.Close()
+	start, err := recordStart(ls)
+	if err != nil {
+		return nil, nil, err
+	}
+	rp, err := recordParser(ls)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range positions {
+		if from != nil && p.Offset < from.Offset {
+			continue
+		}
+		select {
+		case <-j.ctx.Done():
+			return nil, nil, j.ctx.Err()
+		default:
+		}
+		if j.limitReached() {
+			return nil, &cursor{Log: j.log, File: path, Offset: p.Offset, LineNumber: p.LineNumber}, nil
+		}
+		if p.Offset >= size {
+			break
+		}
+		s := newRecordScanner(io.NewSectionReader(r, p.Offset, size-p.Offset), ls, start, rp)
+		s.offset, s.lineNumber = p.Offset, p.LineNumber-1
+		if !s.scan() {
+			if err = s.Err(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		rec := s.Record()
+		if !j.m.Match(rec.Text) {
+			continue
+		}
+		if tr.IsSet() {
+			if t, err := recordTime(rec.FirstLine(), rp, ls); err != nil || !tr.Contains(t) {
+				continue
+			}
+		}
+		j.found++
+		match := model.GrepMatch{GrepLine: model.GrepLine{LineNumber: rec.LineNumber, Offset: rec.Offset, Line: NormalizeText(rec.Text)}}
+		if err := j.emit(path, match); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &cursor{Log: j.log, File: path, Offset: end.Offset, LineNumber: end.LineNumber}, nil, nil
+}
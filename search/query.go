@@ -0,0 +1,403 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//Matcher matches log lines against query
+type Matcher interface {
+	Match(line string) bool
+	//Find byte offsets [start, end) of every match in line
+	Find(line string) [][]int
+}
+
+//NewMatcher creates matcher for query value in given mode
+func NewMatcher(value string, mode string, caseSensitive bool) (Matcher, error) {
+	switch mode {
+	case "", model.QueryPlain:
+		return newPlainMatcher(value, caseSensitive), nil
+	case model.QueryRegex:
+		return newRegexMatcher(value, caseSensitive)
+	case model.QueryBoolean:
+		return newBooleanMatcher(value, caseSensitive)
+	}
+	return nil, fmt.Errorf("Unknown query mode '%v', expected one of %v, %v, %v", mode,
+		model.QueryPlain, model.QueryRegex, model.QueryBoolean)
+}
+
+type plainMatcher struct {
+	value         string
+	caseSensitive bool
+	re            *regexp.Regexp
+}
+
+func newPlainMatcher(value string, caseSensitive bool) *plainMatcher {
+	re := literalRegex(value, caseSensitive)
+	if !caseSensitive {
+		value = strings.ToLower(value)
+	}
+	return &plainMatcher{value: value, caseSensitive: caseSensitive, re: re}
+}
+
+func (m plainMatcher) Match(line string) bool {
+	if !m.caseSensitive {
+		line = strings.ToLower(line)
+	}
+	return strings.Contains(line, m.value)
+}
+
+func (m plainMatcher) Find(line string) [][]int {
+	return findAll(line, m.re)
+}
+
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func newRegexMatcher(value string, caseSensitive bool) (*regexMatcher, error) {
+	pattern := value
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regex '%v', %v", value, err)
+	}
+	return &regexMatcher{re: re}, nil
+}
+
+func (m regexMatcher) Match(line string) bool {
+	return m.re.MatchString(line)
+}
+
+func (m regexMatcher) Find(line string) [][]int {
+	return findAll(line, m.re)
+}
+
+type booleanMatcher struct {
+	root          node
+	caseSensitive bool
+	terms         []*regexp.Regexp
+}
+
+func newBooleanMatcher(value string, caseSensitive bool) (*booleanMatcher, error) {
+	tokens, err := tokenize(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid boolean query '%v', %v", value, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Invalid boolean query '%v', empty query", value)
+	}
+	p := &queryParser{tokens: tokens, caseSensitive: caseSensitive}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%v' at position %v", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid boolean query '%v', %v", value, err)
+	}
+	return &booleanMatcher{root: root, caseSensitive: caseSensitive, terms: positiveTerms(root, false, nil)}, nil
+}
+
+func (m booleanMatcher) Match(line string) bool {
+	if !m.caseSensitive {
+		line = strings.ToLower(line)
+	}
+	return m.root.eval(line)
+}
+
+//Find highlights terms which are not negated
+func (m booleanMatcher) Find(line string) [][]int {
+	return findAll(line, m.terms...)
+}
+
+func positiveTerms(n node, negated bool, out []*regexp.Regexp) []*regexp.Regexp {
+	switch t := n.(type) {
+	case termNode:
+		if !negated && t.re != nil {
+			out = append(out, t.re)
+		}
+	case andNode:
+		out = positiveTerms(t.right, negated, positiveTerms(t.left, negated, out))
+	case orNode:
+		out = positiveTerms(t.right, negated, positiveTerms(t.left, negated, out))
+	case notNode:
+		out = positiveTerms(t.n, !negated, out)
+	}
+	return out
+}
+
+type node interface {
+	eval(line string) bool
+}
+
+type termNode struct {
+	value string
+	re    *regexp.Regexp
+}
+
+func (n termNode) eval(line string) bool {
+	return strings.Contains(line, n.value)
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(line string) bool {
+	return n.left.eval(line) && n.right.eval(line)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(line string) bool {
+	return n.left.eval(line) || n.right.eval(line)
+}
+
+type notNode struct {
+	n node
+}
+
+func (n notNode) eval(line string) bool {
+	return !n.n.eval(line)
+}
+
+type tokenKind int
+
+const (
+	tokTerm tokenKind = iota
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+//tokenize splits query into terms, quoted phrases, parenthesis and AND/OR/NOT operators
+func tokenize(q string) ([]token, error) {
+	tokens := make([]token, 0, 8)
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quote at position %v", start)
+			}
+			if sb.Len() == 0 {
+				return nil, fmt.Errorf("empty phrase at position %v", start)
+			}
+			tokens = append(tokens, token{kind: tokTerm, text: sb.String(), pos: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+			t := token{kind: tokTerm, text: word, pos: start}
+			switch word {
+			case "AND":
+				t.kind = tokAnd
+			case "OR":
+				t.kind = tokOr
+			case "NOT":
+				t.kind = tokNot
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+//queryParser recursive descent parser, NOT binds tighter than AND, AND tighter than OR,
+//adjacent terms without operator are joined with AND
+type queryParser struct {
+	tokens        []token
+	pos           int
+	caseSensitive bool
+}
+
+func (p *queryParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *queryParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokOr; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind != tokOr && t.kind != tokRParen; t = p.peek() {
+		if t.kind == tokAnd {
+			p.pos++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (node, error) {
+	t := p.peek()
+	if t != nil && t.kind == tokNot {
+		p.pos++
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (node, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch t.kind {
+	case tokTerm:
+		p.pos++
+		v := t.text
+		re := literalRegex(v, p.caseSensitive)
+		if !p.caseSensitive {
+			v = strings.ToLower(v)
+		}
+		return termNode{value: v, re: re}, nil
+	case tokLParen:
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.peek(); c == nil || c.kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis for '(' at position %v", t.pos)
+		}
+		p.pos++
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected '%v' at position %v", t.text, t.pos)
+}
+
+//literalRegex regex finding value, nil for empty value
+func literalRegex(value string, caseSensitive bool) *regexp.Regexp {
+	if value == "" {
+		return nil
+	}
+	pattern := regexp.QuoteMeta(value)
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+//findAll sorted, merged byte offsets of non empty matches of all regexes
+func findAll(line string, res ...*regexp.Regexp) [][]int {
+	var out [][]int
+	for _, re := range res {
+		if re == nil {
+			continue
+		}
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			if loc[1] > loc[0] {
+				out = append(out, loc)
+			}
+		}
+	}
+	if len(res) < 2 {
+		return out
+	}
+	sort.Slice(out, func(i int, j int) bool {
+		return out[i][0] < out[j][0]
+	})
+	merged := out[:0]
+	for _, loc := range out {
+		if last := len(merged) - 1; last >= 0 && loc[0] <= merged[last][1] {
+			if loc[1] > merged[last][1] {
+				merged[last][1] = loc[1]
+			}
+			continue
+		}
+		merged = append(merged, loc)
+	}
+	return merged
+}
+
+//Highlights converts byte offsets of matches in line to highlights with rune offsets
+func Highlights(line string, locs [][]int) []model.Highlight {
+	if len(locs) == 0 {
+		return nil
+	}
+	out := make([]model.Highlight, 0, len(locs))
+	runes, pos := 0, 0
+	for _, loc := range locs {
+		runes += utf8.RuneCountInString(line[pos:loc[0]])
+		start := runes
+		runes += utf8.RuneCountInString(line[loc[0]:loc[1]])
+		pos = loc[1]
+		out = append(out, model.Highlight{Start: start, End: runes, ByteStart: loc[0], ByteEnd: loc[1]})
+	}
+	return out
+}
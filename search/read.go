@@ -0,0 +1,176 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//readLines default lines read by Read
+var readLines = 100
+
+//readMaxLines max lines read by Read
+var readMaxLines = 10000
+
+//Read reads lines of log forward from or backward before line addressed by line number or offset
+func Read(req *model.ReadRequest) (*model.ReadResponse, error) {
+	path := req.Log
+	if req.File != "" && req.File != req.Log {
+		files, err := RotationChain(req.Log)
+		if err != nil {
+			return nil, err
+		}
+		if indexOf(files, req.File) < 0 {
+			return nil, fmt.Errorf("%v is not rotation of %v", req.File, req.Log)
+		}
+		path = req.File
+	}
+	if req.Line < 0 || req.Offset < 0 {
+		return nil, fmt.Errorf("Invalid line %v or offset %v", req.Line, req.Offset)
+	}
+	n := req.Lines
+	if n <= 0 {
+		n = readLines
+	}
+	if n > readMaxLines {
+		n = readMaxLines
+	}
+	r, size, closer, err := openReaderAt(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open %v, %v", path, err)
+	}
+	defer closer.Close()
+
+	offset, line := req.Offset, req.Line
+	switch {
+	case offset > 0:
+		if offset > size {
+			return nil, fmt.Errorf("Offset %v is beyond end of %v", offset, path)
+		}
+		if offset, err = lineStart(r, offset); err != nil {
+			return nil, err
+		}
+	case line > 0:
+		if offset, err = lineOffset(r, size, line); err != nil {
+			return nil, err
+		}
+	case req.Backward:
+		offset = size
+	default:
+		line = 1
+	}
+	res := &model.ReadResponse{LogFile: req.Log, Size: size}
+	if path != req.Log {
+		res.File = path
+	}
+	if req.Backward {
+		res.Lines, err = readBackward(r, offset, line, n)
+		res.End = offset
+		res.Start = offset
+	} else {
+		res.Lines, res.End, err = readForward(r, size, offset, line, n)
+		res.Start = offset
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %v, %v", path, err)
+	}
+	if len(res.Lines) > 0 {
+		res.Start = res.Lines[0].Offset
+	}
+	res.BOF = res.Start == 0
+	res.EOF = res.End >= size
+	return res, nil
+}
+
+//readForward reads n lines from offset, returns offset after last line
+func readForward(r io.ReaderAt, size int64, offset int64, line int, n int) ([]model.GrepLine, int64, error) {
+	scanner := bufio.NewScanner(io.NewSectionReader(r, offset, size-offset))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(scanLines)
+	out := make([]model.GrepLine, 0, n)
+	for len(out) < n && scanner.Scan() {
+		b := scanner.Bytes()
+		out = append(out, model.GrepLine{LineNumber: line, Offset: offset, Line: NormalizeText(string(dropEOL(b)))})
+		offset += int64(len(b))
+		if line > 0 {
+			line++
+		}
+	}
+	return out, offset, scanner.Err()
+}
+
+//readBackward reads n lines before line starting at end, line numbers are known when
+//line at end is known or beginning of file is reached
+func readBackward(r io.ReaderAt, end int64, line int, n int) ([]model.GrepLine, error) {
+	lr := newLineReader(r, end)
+	out := make([]model.GrepLine, 0, n)
+	for len(out) < n && lr.scan() {
+		out = append(out, model.GrepLine{Offset: lr.offset, Line: NormalizeText(lr.line)})
+	}
+	if lr.err != nil {
+		return nil, lr.err
+	}
+	reverseLines(out)
+	first := 0
+	switch {
+	case line > 0:
+		first = line - len(out)
+	case len(out) > 0 && out[0].Offset == 0:
+		first = 1
+	}
+	if first > 0 {
+		for i := range out {
+			out[i].LineNumber = first + i
+		}
+	}
+	return out, nil
+}
+
+//lineStart offset of start of line containing offset
+func lineStart(r io.ReaderAt, offset int64) (int64, error) {
+	b := make([]byte, 1)
+	if _, err := r.ReadAt(b, offset-1); err != nil && err != io.EOF {
+		return 0, err
+	}
+	if b[0] == '\n' {
+		return offset, nil
+	}
+	lr := newLineReader(r, offset)
+	if !lr.scan() {
+		return 0, lr.err
+	}
+	return lr.offset, nil
+}
+
+//lineOffset offset of 1-based line counting new lines from start of file
+func lineOffset(r io.ReaderAt, size int64, line int) (int64, error) {
+	buf := make([]byte, 64*1024)
+	var offset int64
+	for left := line - 1; left > 0; {
+		n, err := r.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if n == 0 {
+			break
+		}
+		chunk := buf[:n]
+		for left > 0 {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				chunk = chunk[len(chunk):]
+				break
+			}
+			chunk = chunk[i+1:]
+			left--
+		}
+		offset += int64(n - len(chunk))
+	}
+	if line > 1 && offset >= size {
+		return 0, fmt.Errorf("Line %v is beyond end of file", line)
+	}
+	return offset, nil
+}
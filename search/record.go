@@ -0,0 +1,317 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//maxRecordLines guards against unbounded records when start pattern never matches
+const maxRecordLines = 1000
+
+//Record single log event, spans multiple lines for e.g. java stack traces,
+//LineNumber is 0 when scanning started from an offset
+type Record struct {
+	Text       string
+	LineNumber int
+	Lines      int
+	Offset     int64
+}
+
+//FirstLine first physical line of record
+func (r Record) FirstLine() string {
+	if i := strings.IndexByte(r.Text, '\n'); i >= 0 {
+		return r.Text[:i]
+	}
+	return r.Text
+}
+
+//RecordScanner assembles physical lines into records, a record starts with line matching
+//LogStructure record start pattern and continues until next such line
+type RecordScanner struct {
+	src        io.Reader
+	scanner    *bufio.Scanner
+	start      *regexp.Regexp
+	ls         *model.LogStructure
+	p          parser.Parser
+	tr         TimeRange
+	record     Record
+	next       *Record
+	lineNumber int
+	offset     int64
+	//partial first line when scanning starts in the middle of file, line numbers are unknown then
+	partial bool
+}
+
+//NewRecordScanner creates record scanner, without log structure every line is a record
+func NewRecordScanner(r io.Reader, ls *model.LogStructure) (*RecordScanner, error) {
+	start, err := recordStart(ls)
+	if err != nil {
+		return nil, err
+	}
+	p, err := recordParser(ls)
+	if err != nil {
+		return nil, err
+	}
+	return newRecordScanner(r, ls, start, p), nil
+}
+
+//newRecordScanner record scanner with record start pattern and parser resolved by caller
+func newRecordScanner(r io.Reader, ls *model.LogStructure, start *regexp.Regexp, p parser.Parser) *RecordScanner {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+	scanner.Split(scanLines)
+	return &RecordScanner{src: r, scanner: scanner, start: start, ls: ls, p: p}
+}
+
+//recordParser parser of log structure, nil without log structure
+func recordParser(ls *model.LogStructure) (parser.Parser, error) {
+	if ls == nil {
+		return nil, nil
+	}
+	return parser.Of(ls)
+}
+
+//OpenRecords opens log and returns record scanner limited to time range,
+//sorted uncompressed logs are positioned on first record of range with binary search
+func OpenRecords(path string, ls *model.LogStructure, tr TimeRange) (*RecordScanner, io.Closer, error) {
+	return openRecords(path, ls, tr, 0, 1)
+}
+
+//openRecords opens log at offset of record starting at given line number, 0 when unknown
+func openRecords(path string, ls *model.LogStructure, tr TimeRange, offset int64, lineNumber int) (*RecordScanner, io.Closer, error) {
+	if tr.IsSet() && DateLayout(ls) == "" {
+		return nil, nil, fmt.Errorf("Time range requires log structure with date format")
+	}
+	r, err := OpenLog(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	partial := false
+	if f, ok := r.(*os.File); ok && offset == 0 && !tr.From.IsZero() && ls != nil && ls.Sorted {
+		info, err := f.Stat()
+		if err != nil {
+			r.Close()
+			return nil, nil, err
+		}
+		if offset, _, err = seekTime(f, info.Size(), ls, tr.From); err != nil {
+			r.Close()
+			return nil, nil, fmt.Errorf("Could not seek %v to %v, %v", path, tr.From, err)
+		}
+		partial = offset > 0
+	}
+	if offset > 0 {
+		if err = skip(r, offset); err != nil {
+			r.Close()
+			return nil, nil, fmt.Errorf("Could not skip to %v in %v, %v", offset, path, err)
+		}
+	}
+	s, err := NewRecordScanner(r, ls)
+	if err != nil {
+		r.Close()
+		return nil, nil, err
+	}
+	s.tr = tr
+	s.offset = offset
+	switch {
+	case partial:
+		s.partial = true
+	case lineNumber > 0:
+		s.lineNumber = lineNumber - 1
+	case offset > 0:
+		s.lineNumber = -1
+	}
+	return s, r, nil
+}
+
+//skip moves reader n bytes forward, compressed readers are read through
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(ioutil.Discard, r, n)
+	return err
+}
+
+//Scan advances to next record in time range
+func (s *RecordScanner) Scan() bool {
+	for s.scan() {
+		if !s.tr.IsSet() {
+			return true
+		}
+		t, err := recordTime(s.record.FirstLine(), s.p, s.ls)
+		if err != nil {
+			continue
+		}
+		if s.tr.After(t) && s.ls.Sorted {
+			return false
+		}
+		if s.tr.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *RecordScanner) scan() bool {
+	if s.next == nil && !s.readLine() {
+		return false
+	}
+	s.record = *s.next
+	s.next = nil
+	if s.start == nil {
+		return true
+	}
+	var sb *strings.Builder
+	for s.readLine() {
+		if s.record.Lines >= maxRecordLines || s.start.MatchString(s.next.Text) {
+			break
+		}
+		if sb == nil {
+			sb = &strings.Builder{}
+			sb.WriteString(s.record.Text)
+		}
+		sb.WriteByte('\n')
+		sb.WriteString(s.next.Text)
+		s.record.Lines++
+		s.next = nil
+	}
+	if sb != nil {
+		s.record.Text = sb.String()
+	}
+	return true
+}
+
+//Record current record
+func (s *RecordScanner) Record() *Record {
+	return &s.record
+}
+
+//Scanned bytes consumed from underlying file, compressed size for gzip files
+func (s *RecordScanner) Scanned() int64 {
+	if c, ok := s.src.(interface{ Consumed() int64 }); ok {
+		return c.Consumed()
+	}
+	return s.offset
+}
+
+//Err scanner error
+func (s *RecordScanner) Err() error {
+	return s.scanner.Err()
+}
+
+func (s *RecordScanner) readLine() bool {
+	if !s.scanner.Scan() {
+		return false
+	}
+	b := s.scanner.Bytes()
+	if s.partial && s.lineNumber == 0 {
+		s.offset += int64(len(b))
+		s.lineNumber = -1
+		return s.readLine()
+	}
+	lineNumber := 0
+	if s.lineNumber >= 0 {
+		s.lineNumber++
+		lineNumber = s.lineNumber
+	}
+	s.next = &Record{Text: string(dropEOL(b)), LineNumber: lineNumber, Lines: 1, Offset: s.offset}
+	s.offset += int64(len(b))
+	return true
+}
+
+//scanLines like bufio.ScanLines but keeps line endings so byte offsets can be tracked
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[0 : i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func dropEOL(b []byte) []byte {
+	if len(b) > 0 && b[len(b)-1] == '\n' {
+		b = b[:len(b)-1]
+	}
+	if len(b) > 0 && b[len(b)-1] == '\r' {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+//recordStart pattern from LogStructure, explicit RecordStart or one derived from date format
+func recordStart(ls *model.LogStructure) (*regexp.Regexp, error) {
+	if ls == nil {
+		return nil, nil
+	}
+	if _, err := parser.Of(ls); err != nil {
+		return nil, err
+	}
+	if ls.RecordStart != "" {
+		re, err := regexp.Compile(ls.RecordStart)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid record start pattern '%v', %v", ls.RecordStart, err)
+		}
+		return re, nil
+	}
+	switch ls.Format {
+	case model.FormatRegex:
+		//continuation lines do not match pattern of record
+		return parser.Pattern(ls)
+	case model.FormatJSON:
+		return jsonRecordStart, nil
+	case model.FormatLogfmt:
+		return nil, nil
+	}
+	layout := DateLayout(ls)
+	if layout == "" || ls.Date < 0 {
+		return nil, nil
+	}
+	prefix := "^"
+	if ls.Date > 0 {
+		switch ls.Delimiter {
+		case "", "|":
+			prefix = fmt.Sprintf(`^(?:[^|]*\|){%d}\s*`, ls.Date)
+		case " ":
+			prefix = fmt.Sprintf(`^\s*(?:\S+\s+){%d}`, ls.Date)
+		default:
+			prefix = fmt.Sprintf(`^(?:.*?%v){%d}\s*`, regexp.QuoteMeta(ls.Delimiter), ls.Date)
+		}
+	}
+	return regexp.MustCompile(prefix + layoutPattern(layout)), nil
+}
+
+//jsonRecordStart json records start with object on new line
+var jsonRecordStart = regexp.MustCompile(`^\s*\{`)
+
+//layoutPattern converts date layout to regex, digits match any digit and letters any letter
+func layoutPattern(layout string) string {
+	var sb strings.Builder
+	for _, r := range layout {
+		switch {
+		case unicode.IsDigit(r):
+			sb.WriteString(`\d`)
+		case unicode.IsLetter(r):
+			sb.WriteString(`[A-Za-z]`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return sb.String()
+}
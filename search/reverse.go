@@ -0,0 +1,297 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//reverseBlockSize bytes read at once when reading file backwards
+var reverseBlockSize int64 = 64 * 1024
+
+//lineReader reads lines of [0, end) backwards, last line first
+type lineReader struct {
+	r        io.ReaderAt
+	end      int64
+	bufStart int64
+	buf      []byte
+	line     string
+	offset   int64
+	err      error
+}
+
+func newLineReader(r io.ReaderAt, end int64) *lineReader {
+	return &lineReader{r: r, end: end, bufStart: end}
+}
+
+//scan moves to previous line
+func (lr *lineReader) scan() bool {
+	if lr.err != nil {
+		return false
+	}
+	for {
+		if len(lr.buf) == 0 && lr.bufStart == 0 {
+			return false
+		}
+		//newline terminating current line is not its start
+		search := lr.buf
+		if len(search) > 0 && search[len(search)-1] == '\n' {
+			search = search[:len(search)-1]
+		}
+		if i := bytes.LastIndexByte(search, '\n'); i >= 0 || lr.bufStart == 0 {
+			lr.line = string(dropEOL(lr.buf[i+1:]))
+			lr.offset = lr.bufStart + int64(i+1)
+			lr.buf = lr.buf[:i+1]
+			return true
+		}
+		if !lr.readBlock() {
+			return false
+		}
+	}
+}
+
+func (lr *lineReader) readBlock() bool {
+	start := lr.bufStart - reverseBlockSize
+	if start < 0 {
+		start = 0
+	}
+	block := make([]byte, lr.bufStart-start, int64(len(lr.buf))+lr.bufStart-start)
+	if _, err := lr.r.ReadAt(block, start); err != nil && err != io.EOF {
+		lr.err = err
+		return false
+	}
+	lr.buf = append(block, lr.buf...)
+	lr.bufStart = start
+	return true
+}
+
+//ReverseRecordScanner assembles records reading file backwards, newest record first
+type ReverseRecordScanner struct {
+	lines  *lineReader
+	start  *regexp.Regexp
+	ls     *model.LogStructure
+	p      parser.Parser
+	tr     TimeRange
+	record Record
+}
+
+//Scan moves to previous record in time range
+func (s *ReverseRecordScanner) Scan() bool {
+	for s.scan() {
+		if !s.tr.IsSet() {
+			return true
+		}
+		t, err := recordTime(s.record.FirstLine(), s.p, s.ls)
+		if err != nil {
+			continue
+		}
+		if !s.tr.From.IsZero() && t.Before(s.tr.From) && s.ls.Sorted {
+			return false
+		}
+		if s.tr.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ReverseRecordScanner) scan() bool {
+	cont := make([]string, 0)
+	var offset int64
+	for s.lines.scan() {
+		cont = append(cont, s.lines.line)
+		offset = s.lines.offset
+		if s.start == nil || len(cont) >= maxRecordLines || s.start.MatchString(s.lines.line) {
+			break
+		}
+	}
+	if len(cont) == 0 {
+		return false
+	}
+	for i, j := 0, len(cont)-1; i < j; i, j = i+1, j-1 {
+		cont[i], cont[j] = cont[j], cont[i]
+	}
+	s.record = Record{Text: strings.Join(cont, "\n"), Lines: len(cont), Offset: offset}
+	return true
+}
+
+//Record current record, line numbers are unknown when reading backwards
+func (s *ReverseRecordScanner) Record() *Record {
+	return &s.record
+}
+
+//Err read error
+func (s *ReverseRecordScanner) Err() error {
+	return s.lines.err
+}
+
+//Scanned bytes read from end
+func (s *ReverseRecordScanner) Scanned() int64 {
+	return s.lines.end - s.record.Offset
+}
+
+//OpenReverseRecords opens log for reading records backwards from end offset, 0 is end of file,
+//sorted uncompressed logs are positioned at the end of time range with binary search, compressed
+//logs are read through window of gzipReaderAt which decompresses them again for every window
+//read backwards
+func OpenReverseRecords(path string, ls *model.LogStructure, tr TimeRange, end int64) (*ReverseRecordScanner, io.Closer, error) {
+	if tr.IsSet() && DateLayout(ls) == "" {
+		return nil, nil, fmt.Errorf("Time range requires log structure with date format")
+	}
+	start, err := recordStart(ls)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := recordParser(ls)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, size, closer, err := openReaderAt(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if end <= 0 || end > size {
+		end = size
+		if !tr.To.IsZero() && ls.Sorted && !IsCompressed(path) {
+			if _, hi, err := seekTime(r, size, ls, tr.To); err == nil {
+				end = recordAfter(r, hi, size, ls)
+			}
+		}
+	}
+	return &ReverseRecordScanner{lines: newLineReader(r, end), start: start, ls: ls, p: p, tr: tr}, closer, nil
+}
+
+//openReaderAt opens file for random access, compressed files are streamed forward keeping
+//gzipWindow decompressed bytes
+func openReaderAt(path string) (io.ReaderAt, int64, io.Closer, error) {
+	if IsCompressed(path) {
+		g, err := openGzipReaderAt(path, gzipWindow)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return g, g.size, g, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, err
+	}
+	return f, info.Size(), f, nil
+}
+
+//gzipWindow decompressed bytes of compressed log kept at least for random access
+var gzipWindow = 4 * 1024 * 1024
+
+//gzipReaderAt random access to compressed log without decompressing it to memory, log is
+//streamed forward keeping at least window bytes before stream position and reopened when
+//earlier bytes are read, so reading backwards far from end decompresses log again, it is not
+//safe for concurrent use
+type gzipReaderAt struct {
+	path   string
+	window int
+	rc     io.ReadCloser
+	pos    int64
+	buf    []byte
+	block  []byte
+	size   int64
+}
+
+//openGzipReaderAt opens compressed log and streams it to end to get its decompressed size
+func openGzipReaderAt(path string, window int) (*gzipReaderAt, error) {
+	g := &gzipReaderAt{path: path, window: window, block: make([]byte, reverseBlockSize)}
+	if err := g.reopen(); err != nil {
+		return nil, err
+	}
+	for {
+		more, err := g.fill()
+		if err != nil {
+			g.Close()
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	g.size = g.pos
+	return g, nil
+}
+
+func (g *gzipReaderAt) reopen() error {
+	if g.rc != nil {
+		g.rc.Close()
+		g.rc = nil
+	}
+	rc, err := OpenLog(g.path)
+	if err != nil {
+		return err
+	}
+	g.rc, g.pos, g.buf = rc, 0, g.buf[:0]
+	return nil
+}
+
+//fill reads next block of stream, buffer is cut to last window bytes when it would exceed
+//twice the window, false at end of stream
+func (g *gzipReaderAt) fill() (bool, error) {
+	n, err := g.rc.Read(g.block)
+	if len(g.buf)+n > 2*g.window && len(g.buf) > g.window {
+		g.buf = g.buf[:copy(g.buf, g.buf[len(g.buf)-g.window:])]
+	}
+	g.buf = append(g.buf, g.block[:n]...)
+	g.pos += int64(n)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Could not decompress %v, %v", g.path, err)
+	}
+	return true, nil
+}
+
+//ReadAt reads from buffer, stream is read forward up to off or reopened when off is before buffer
+func (g *gzipReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		o := off + int64(n)
+		if o >= g.size {
+			return n, io.EOF
+		}
+		start := g.pos - int64(len(g.buf))
+		switch {
+		case o < start:
+			if err := g.reopen(); err != nil {
+				return n, err
+			}
+		case o >= g.pos:
+			more, err := g.fill()
+			if err != nil {
+				return n, err
+			}
+			if !more && o >= g.pos {
+				return n, io.ErrUnexpectedEOF
+			}
+		default:
+			n += copy(p[n:], g.buf[o-start:])
+		}
+	}
+	return n, nil
+}
+
+//Close closes stream
+func (g *gzipReaderAt) Close() error {
+	if g.rc == nil {
+		return nil
+	}
+	err := g.rc.Close()
+	g.rc = nil
+	return err
+}
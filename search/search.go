@@ -1,7 +1,6 @@
 package search
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -10,6 +9,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	l "github.com/RomanLorens/logger/log"
@@ -19,63 +19,95 @@ import (
 
 var tailSizeKB = 16
 
-//Grep grep logs
-func Grep(ctx context.Context, req *model.GrepRequest, logger l.Logger) []model.GrepResponse {
-	out := make([]model.GrepResponse, 0, len(req.Logs))
-	for _, l := range req.Logs {
-		logger.Info(ctx, "Local grep for %v - '%v'", l, req.Value)
-		r := model.GrepResponse{LogFile: l}
-		lines, err := grepFile(l, req.Value)
-		if err != nil {
-			logger.Error(ctx, "Could not grep %v, %v", l, err)
-			continue
-		}
-		r.Lines = lines
-		out = append(out, r)
-	}
-	return out
-}
+//grepWorkers max logs searched concurrently by Grep
+var grepWorkers = 4
 
-//DownloadLog read file
-func DownloadLog(log string) ([]byte, error) {
-	b, err := ioutil.ReadFile(log)
+//progressStep bytes scanned between progress events of streamed grep
+var progressStep int64 = 1024 * 1024
+
+//Grep grep logs, logs are searched concurrently by bounded pool of workers
+func Grep(ctx context.Context, req *model.GrepRequest, logger l.Logger) ([]model.GrepResponse, error) {
+	m, err := newRequestMatcher(req)
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	host, err := utils.Hostname()
+	if err != nil {
+		logger.Error(ctx, "Could not resolve hostname, %v", err)
+	}
+	out := make([]model.GrepResponse, len(req.Logs))
+	jobs := make(chan int)
+	workers := grepWorkers
+	if len(req.Logs) < workers {
+		workers = len(req.Logs)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out[i] = model.GrepResponse{LogFile: req.Logs[i], Host: host, Lines: make([]model.GrepMatch, 0, 20)}
+				grep(ctx, &out[i], m, req, logger)
+			}
+		}()
+	}
+	for i := range req.Logs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return out, nil
 }
 
-func grepFile(path string, value string) ([]string, error) {
-	out := make([]string, 0, 20)
-	f, err := os.Open(path)
+func grep(ctx context.Context, r *model.GrepResponse, m Matcher, req *model.GrepRequest, logger l.Logger) {
+	defer utils.CatchError(ctx, logger)
+	start := time.Now()
+	logger.Info(ctx, "Local grep for %v - '%v'", r.LogFile, req.Value)
+	job := &grepJob{ctx: ctx, log: r.LogFile, m: m, req: req, onMatch: func(match model.GrepMatch) error {
+		r.Lines = append(r.Lines, match)
+		return nil
+	}}
+	cursor, err := job.run()
+	r.Time = time.Now().Sub(start).Milliseconds()
 	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-	val := strings.ToLower(value)
-	for scanner.Scan() {
-		if strings.Contains(strings.ToLower(scanner.Text()), val) {
-			out = append(out, NormalizeText(scanner.Text()))
-		}
+		logger.Error(ctx, "Could not grep %v, %v", r.LogFile, err)
+		r.Error = err.Error()
+		return
 	}
-	if err = scanner.Err(); err != nil {
+	r.Cursor = cursor
+}
+
+//DownloadLog read file
+func DownloadLog(log string) ([]byte, error) {
+	b, err := ioutil.ReadFile(log)
+	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	return b, nil
 }
 
 //Tail tail log
-func Tail(log string) (*model.TailLogResponse, error) {
-	res, _, err := TailLogIfNewer(log, 0)
+func Tail(req *model.LogRequest) (*model.TailLogResponse, error) {
+	res, _, err := tailLog(req, 0, false)
 	return res, err
 }
 
-//TailLogIfNewer tail log
-func TailLogIfNewer(log string, modtime int64) (*model.TailLogResponse, bool, error) {
+//TailLogIfNewer tail log when modified after modtime
+func TailLogIfNewer(req *model.LogRequest, modtime int64) (*model.TailLogResponse, bool, error) {
+	r := *req
+	r.History = false
+	return tailLog(&r, modtime, false)
+}
+
+//tailLog tails log modified after modtime, complete leaves out last line not terminated yet
+func tailLog(req *model.LogRequest, modtime int64, complete bool) (*model.TailLogResponse, bool, error) {
 	start := time.Now()
+	log := req.Log
+	filter, err := newRecordFilter(req)
+	if err != nil {
+		return nil, true, err
+	}
 	file, err := os.Open(log)
 	if err != nil {
 		return nil, true, fmt.Errorf("Could not open file %v", err)
@@ -88,7 +120,23 @@ func TailLogIfNewer(log string, modtime int64) (*model.TailLogResponse, bool, er
 	if modtime >= info.ModTime().Unix() {
 		return nil, false, nil
 	}
-	offset := info.Size() - int64(tailSizeKB*1024)
+	res := &model.TailLogResponse{
+		Lines:   make([]string, 0, 100),
+		LogFile: log,
+		ModTime: info.ModTime().Unix(),
+	}
+	if req.Lines > 0 {
+		if err = tailRecords(req, filter.m, complete, res); err != nil {
+			return nil, true, err
+		}
+		res.Time = time.Now().Sub(start).Milliseconds()
+		return res, true, nil
+	}
+	max := int64(tailSizeKB * 1024)
+	if req.MaxBytes > 0 {
+		max = req.MaxBytes
+	}
+	offset := info.Size() - max
 	if offset < 0 {
 		offset = 0
 	}
@@ -98,28 +146,98 @@ func TailLogIfNewer(log string, modtime int64) (*model.TailLogResponse, bool, er
 	if err != nil && err != io.EOF {
 		return nil, true, fmt.Errorf("Could not stat file %v", err)
 	}
+	res.Offset = info.Size()
+	if complete {
+		bytes = bytes[:completeLines(bytes)]
+		res.Offset = offset + int64(len(bytes))
+	}
+
+	partial := offset > 0
+	if req.History && !partial {
+		prev, cut, err := tailRotations(log, max-int64(len(bytes)))
+		if err != nil {
+			return nil, true, err
+		}
+		bytes = append(prev, bytes...)
+		partial = cut
+	}
 
 	//start from new line
 	for i, b := range bytes {
+		if !partial {
+			break
+		}
 		if b == '\n' {
 			bytes = bytes[i:]
 			break
 		}
 	}
 
-	lines := make([]string, 0, 100)
-	for _, l := range strings.Split(string(bytes), "\n") {
-		l = NormalizeText(l)
-		if strings.TrimSpace(l) != "" {
-			lines = append(lines, NormalizeText(l))
+	filter.appendLines(res, string(bytes))
+	res.Time = time.Now().Sub(start).Milliseconds()
+	return res, true, nil
+}
+
+//tailRotations reads last n bytes from rotations preceding log, newest rotation last
+func tailRotations(log string, n int64) ([]byte, bool, error) {
+	chain, err := RotationChain(log)
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([]byte, 0, n)
+	for i := len(chain) - 1; i >= 0 && n > 0; i-- {
+		if chain[i] == log {
+			continue
+		}
+		b, cut, err := readTail(chain[i], n)
+		if err != nil {
+			return nil, false, fmt.Errorf("Could not read %v, %v", chain[i], err)
+		}
+		out = append(b, out...)
+		n -= int64(len(b))
+		if cut {
+			return out, true, nil
+		}
+	}
+	return out, false, nil
+}
+
+//readTail reads last n bytes of file, compressed files are streamed keeping last n bytes
+func readTail(path string, n int64) ([]byte, bool, error) {
+	if IsCompressed(path) {
+		g, err := openGzipReaderAt(path, int(n))
+		if err != nil {
+			return nil, false, err
 		}
+		defer g.Close()
+		offset := g.size - n
+		if offset < 0 {
+			offset = 0
+		}
+		b := make([]byte, g.size-offset)
+		if _, err = g.ReadAt(b, offset); err != nil && err != io.EOF {
+			return nil, false, err
+		}
+		return b, offset > 0, nil
 	}
-	return &model.TailLogResponse{
-		Lines:   lines,
-		Time:    time.Now().Sub(start).Milliseconds(),
-		LogFile: log,
-		ModTime: info.ModTime().Unix(),
-	}, true, nil
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	offset := info.Size() - n
+	if offset < 0 {
+		offset = 0
+	}
+	b := make([]byte, info.Size()-offset)
+	if _, err = f.ReadAt(b, offset); err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	return b, offset > 0, nil
 }
 
 //ListLogs list logs
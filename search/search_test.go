@@ -1,17 +1,961 @@
 package search
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
 )
 
 func TestListLogs(t *testing.T) {
 
-	ld := ListLogs(context.Background(), []string{"../../test-logs/"}, log.PrintLogger(false))
+	ld := ListLogs(context.Background(), []string{"../test-logs/"}, log.PrintLogger(false))
 
 	if len(ld) == 0 {
 		t.Error("should not be empty")
 	}
 }
+
+func TestMatcher(t *testing.T) {
+	line := "2021-05-06 11:27:58,453|ERROR|ab12345|reqid=X|request took 12345ms"
+	tests := []struct {
+		value         string
+		mode          string
+		caseSensitive bool
+		match         bool
+	}{
+		{"error", model.QueryPlain, false, true},
+		{"error", model.QueryPlain, true, false},
+		{`took \d{4,}ms`, model.QueryRegex, false, true},
+		{`took \d{6,}ms`, model.QueryRegex, false, false},
+		{`ERROR AND reqid=X NOT healthcheck`, model.QueryBoolean, false, true},
+		{`ERROR reqid=Y`, model.QueryBoolean, false, false},
+		{`(INFO OR error) AND "request took"`, model.QueryBoolean, false, true},
+		{`NOT (ERROR OR INFO)`, model.QueryBoolean, false, false},
+		{`"AND"`, model.QueryBoolean, true, false},
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.value, tt.mode, tt.caseSensitive)
+		if err != nil {
+			t.Fatalf("%v - %v", tt.value, err)
+		}
+		if m.Match(line) != tt.match {
+			t.Errorf("'%v' (%v) expected match %v", tt.value, tt.mode, tt.match)
+		}
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	line := "żółw ERROR took 12ms, error again"
+	tests := []struct {
+		value string
+		mode  string
+		want  []model.Highlight
+	}{
+		{"error", model.QueryPlain, []model.Highlight{{Start: 5, End: 10, ByteStart: 8, ByteEnd: 13}, {Start: 22, End: 27, ByteStart: 25, ByteEnd: 30}}},
+		{`\d+ms`, model.QueryRegex, []model.Highlight{{Start: 16, End: 20, ByteStart: 19, ByteEnd: 23}}},
+		{`took OR "took 12" NOT again`, model.QueryBoolean, []model.Highlight{{Start: 11, End: 18, ByteStart: 14, ByteEnd: 21}}},
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.value, tt.mode, false)
+		if err != nil {
+			t.Fatalf("%v - %v", tt.value, err)
+		}
+		got := Highlights(line, m.Find(line))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("'%v' expected %v, got %v", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestTailFilter(t *testing.T) {
+	f, err := ioutil.TempFile("", "tail-filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a|INFO|ok\nb|ERROR|failed\nc|INFO|fine\n")
+	f.Close()
+	res, err := Tail(&model.LogRequest{Log: f.Name(), Filter: &model.TailFilter{Value: "error"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lines) != 1 || res.Lines[0] != "b|ERROR|failed" {
+		t.Fatalf("expected only error line, got %v", res.Lines)
+	}
+	want := [][]model.Highlight{{{Start: 2, End: 7, ByteStart: 2, ByteEnd: 7}}}
+	if !reflect.DeepEqual(res.Highlights, want) {
+		t.Errorf("expected %v, got %v", want, res.Highlights)
+	}
+}
+
+func TestMatcherInvalid(t *testing.T) {
+	invalid := []struct {
+		value string
+		mode  string
+	}{
+		{`took (\d+ms`, model.QueryRegex},
+		{`ERROR AND`, model.QueryBoolean},
+		{`(ERROR OR INFO`, model.QueryBoolean},
+		{`"unterminated`, model.QueryBoolean},
+		{`""`, model.QueryBoolean},
+		{`ERROR AND ""`, model.QueryBoolean},
+		{`ERROR )`, model.QueryBoolean},
+		{``, model.QueryBoolean},
+		{`ERROR`, "fuzzy"},
+	}
+	for _, tt := range invalid {
+		if _, err := NewMatcher(tt.value, tt.mode, false); err == nil {
+			t.Errorf("'%v' (%v) should be invalid", tt.value, tt.mode)
+		}
+	}
+}
+
+func TestGrepContext(t *testing.T) {
+	f, err := ioutil.TempFile("", "grep-context-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	for i := 1; i <= 10; i++ {
+		v := "line"
+		if i == 3 || i == 5 || i == 9 {
+			v = "hit"
+		}
+		fmt.Fprintf(f, "%v %v\n", v, i)
+	}
+	f.Close()
+
+	res, err := Grep(context.Background(), &model.GrepRequest{Value: "hit", Logs: []string{f.Name()}, Before: 2, After: 1},
+		log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbers := func(lines []model.GrepLine) []int {
+		out := make([]int, 0, len(lines))
+		for _, l := range lines {
+			out = append(out, l.LineNumber)
+		}
+		return out
+	}
+	expected := []struct {
+		line   int
+		before []int
+		after  []int
+	}{{3, []int{1, 2}, []int{4}}, {5, []int{}, []int{6}}, {9, []int{7, 8}, []int{10}}}
+	matches := res[0].Lines
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %v matches, got %v", len(expected), matches)
+	}
+	for i, e := range expected {
+		m := matches[i]
+		if m.LineNumber != e.line || !reflect.DeepEqual(numbers(m.Before), e.before) || !reflect.DeepEqual(numbers(m.After), e.after) {
+			t.Errorf("expected %v, got %v", e, m)
+		}
+	}
+}
+
+func TestGrepMultiLineRecords(t *testing.T) {
+	f, err := ioutil.TempFile("", "grep-records-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`2021-05-06 11:27:58,453|exec-1|INFO|LogFilter|ab12345|req-1|start
+2021-05-06 11:27:58,455|exec-1|ERROR|AppExceptionHandler|ab12345|req-1|failed
+java.lang.NullPointerException: null
+	at com.app.Service.run(Service.java:42)
+	at com.app.Controller.handle(Controller.java:17)
+2021-05-06 11:27:58,460|exec-1|INFO|LogFilter|ab12345|req-1|done
+`)
+	f.Close()
+
+	ls := &model.LogStructure{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6, DateFormat: "2006-01-02 15:04:05"}
+	res, err := Grep(context.Background(), &model.GrepRequest{Value: "NullPointerException", Logs: []string{f.Name()},
+		LogStructure: ls, After: 1}, log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res[0].Lines) != 1 {
+		t.Fatalf("expected 1 record, got %v", res[0].Lines)
+	}
+	m := res[0].Lines[0]
+	if m.LineNumber != 2 || !strings.HasPrefix(m.Line, "2021-05-06 11:27:58,455") || !strings.Contains(m.Line, "Controller.java:17") {
+		t.Errorf("expected whole record with stack trace, got %v", m.Line)
+	}
+	if len(m.After) != 1 || m.After[0].LineNumber != 6 {
+		t.Errorf("expected next record as context, got %v", m.After)
+	}
+}
+
+func TestJavaDateLayout(t *testing.T) {
+	tests := map[string]string{
+		"yyyy-MM-dd HH:mm:ss,SSS":    "2006-01-02 15:04:05,000",
+		"dd/MMM/yyyy:HH:mm:ss Z":     "02/Jan/2006:15:04:05 -0700",
+		"yyyy-MM-dd'T'HH:mm:ss.SSSX": "2006-01-02T15:04:05.000-07",
+	}
+	for java, layout := range tests {
+		if l := JavaDateLayout(java); l != layout {
+			t.Errorf("%v expected %v, got %v", java, layout, l)
+		}
+	}
+	ls := &model.LogStructure{JavaDateFormat: "yyyy-MM-dd HH:mm:ss,SSS"}
+	d, err := ParseTime("2021-05-06 11:27:58,453", ls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Nanosecond() != 453*int(time.Millisecond) || d.Second() != 58 {
+		t.Errorf("wrong time %v", d)
+	}
+}
+
+func TestGrepTimeRangeSorted(t *testing.T) {
+	f, err := ioutil.TempFile("", "grep-time-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	start := time.Date(2021, 5, 6, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(f, "%v|INFO|user|req-%v|message\n", start.Add(time.Duration(i)*time.Second).Format("2006-01-02 15:04:05,000"), i)
+	}
+	f.Close()
+
+	ls := &model.LogStructure{Date: 0, Level: 1, User: 2, Reqid: 3, Message: 4, JavaDateFormat: "yyyy-MM-dd HH:mm:ss,SSS", Sorted: true}
+	from := start.Add(15000 * time.Second)
+	req := &model.GrepRequest{Value: "message", Logs: []string{f.Name()}, LogStructure: ls,
+		FromTime: from.UnixNano() / int64(time.Millisecond), ToTime: from.Add(10*time.Second).UnixNano() / int64(time.Millisecond)}
+	res, err := Grep(context.Background(), req, log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := res[0].Lines
+	if len(lines) != 10 || !strings.Contains(lines[0].Line, "req-15000|") || !strings.Contains(lines[9].Line, "req-15009|") {
+		t.Fatalf("expected req-15000..req-15009, got %v", lines)
+	}
+	if lines[0].LineNumber != 0 || lines[0].Offset == 0 {
+		t.Errorf("expected unknown line number and known offset, got %v", lines[0])
+	}
+
+	req.Reverse = true
+	res, err = Grep(context.Background(), req, log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = res[0].Lines
+	if len(lines) != 10 || !strings.Contains(lines[0].Line, "req-15009|") || !strings.Contains(lines[9].Line, "req-15000|") {
+		t.Fatalf("expected req-15009..req-15000, got %v", lines)
+	}
+}
+
+func TestRotationChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	write := func(name string, content string, age time.Duration) {
+		p := filepath.Join(dir, name)
+		var b bytes.Buffer
+		if strings.HasSuffix(name, ".gz") {
+			gz := gzip.NewWriter(&b)
+			gz.Write([]byte(content))
+			gz.Close()
+		} else {
+			b.WriteString(content)
+		}
+		if err := ioutil.WriteFile(p, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, now.Add(-age), now.Add(-age))
+	}
+	write("app.log", "current hit\n", 0)
+	write("app.log.1", "first rotation hit\n", time.Hour)
+	write("app-2021-05-05.log.gz", "compressed hit\n", 2*time.Hour)
+	write("app-access.log", "other log hit\n", 0)
+	write("app.log.bak", "backup hit\n", 0)
+	write("app.log.lock", "lock hit\n", 0)
+	write("app.log.idx", "index hit\n", 0)
+
+	app := filepath.Join(dir, "app.log")
+	chain, err := RotationChain(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "app-2021-05-05.log.gz"), filepath.Join(dir, "app.log.1"), app}
+	if !reflect.DeepEqual(chain, expected) {
+		t.Fatalf("expected %v, got %v", expected, chain)
+	}
+
+	res, err := Grep(context.Background(), &model.GrepRequest{Value: "hit", Logs: []string{app}, History: true}, log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := res[0].Lines
+	if len(lines) != 3 || lines[0].Line != "compressed hit" || lines[0].File != expected[0] || lines[2].File != "" {
+		t.Errorf("expected matches from whole chain, got %v", lines)
+	}
+
+	tail, err := Tail(&model.LogRequest{Log: app, History: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tail.Lines, []string{"compressed hit", "first rotation hit", "current hit"}) {
+		t.Errorf("expected tail from whole chain, got %v", tail.Lines)
+	}
+}
+
+func TestGrepStreamCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	matches := 0
+	err := GrepStream(ctx, &model.GrepRequest{Value: "INFO", Logs: []string{"../test-logs/java-app.log"}}, log.PrintLogger(false),
+		func(e *model.GrepEvent) error {
+			if e.Type == model.GrepEventMatch {
+				matches++
+				cancel()
+			}
+			return nil
+		})
+	if err != context.Canceled {
+		t.Errorf("expected cancelled search, got %v", err)
+	}
+	if matches != 1 {
+		t.Errorf("expected search to stop early, got %v matches", matches)
+	}
+}
+
+func TestGrepPagination(t *testing.T) {
+	f, err := ioutil.TempFile("", "grep-pages-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	for i := 1; i <= 100; i++ {
+		v := "line"
+		if i%4 == 0 || i == 97 {
+			v = "hit"
+		}
+		fmt.Fprintf(f, "%v %v\n", v, i)
+	}
+	f.Close()
+
+	req := &model.GrepRequest{Value: "hit", Logs: []string{f.Name()}, MaxResults: 10, After: 1}
+	seen := make([]int, 0, 26)
+	lines := make(map[int]bool)
+	for page := 0; page < 10; page++ {
+		res, err := Grep(context.Background(), req, log.PrintLogger(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res[0].Lines) > 10 {
+			t.Fatalf("page exceeds limit, %v", res[0].Lines)
+		}
+		for _, m := range res[0].Lines {
+			seen = append(seen, m.LineNumber)
+			for _, l := range append(m.After, m.GrepLine) {
+				if lines[l.LineNumber] {
+					t.Errorf("line %v returned twice", l.LineNumber)
+				}
+				lines[l.LineNumber] = true
+			}
+		}
+		if res[0].Cursor == "" {
+			break
+		}
+		req.Cursors = []string{res[0].Cursor}
+	}
+	if len(seen) != 26 || seen[0] != 4 || seen[24] != 97 || seen[25] != 100 {
+		t.Errorf("expected all 26 matches in order, got %v", seen)
+	}
+}
+
+func TestGrepReverse(t *testing.T) {
+	defer func(size int64) { reverseBlockSize = size }(reverseBlockSize)
+	reverseBlockSize = 50
+	f, err := ioutil.TempFile("", "grep-reverse-*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	expected := make([]string, 0, 25)
+	for i := 1; i <= 100; i++ {
+		if i%4 == 0 {
+			fmt.Fprintf(f, "2021-05-06 11:27:%02d|ERROR|hit %v\n\tat Service.java:%v\n", i%60, i, i)
+			expected = append([]string{fmt.Sprintf("2021-05-06 11:27:%02d|ERROR|hit %v\n\tat Service.java:%v", i%60, i, i)}, expected...)
+			continue
+		}
+		fmt.Fprintf(f, "2021-05-06 11:27:%02d|INFO|line %v\n", i%60, i)
+	}
+	f.Close()
+
+	ls := &model.LogStructure{Date: 0, Level: 1, Message: 2, DateFormat: "2006-01-02 15:04:05"}
+	req := &model.GrepRequest{Value: "hit", Logs: []string{f.Name()}, MaxResults: 10, Before: 1, Reverse: true, LogStructure: ls}
+	found := make([]string, 0, 25)
+	for page := 0; page < 10; page++ {
+		res, err := Grep(context.Background(), req, log.PrintLogger(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res[0].Error != "" {
+			t.Fatal(res[0].Error)
+		}
+		for _, m := range res[0].Lines {
+			found = append(found, m.Line)
+			if len(m.Before) != 1 || m.Before[0].Offset >= m.Offset || !strings.Contains(m.Before[0].Line, "|INFO|line") {
+				t.Errorf("expected preceding line as before context of %v, got %v", m.Line, m.Before)
+			}
+		}
+		if res[0].Cursor == "" {
+			break
+		}
+		req.Cursors = []string{res[0].Cursor}
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected newest first %v, got %v", expected, found)
+	}
+}
+
+func TestRead(t *testing.T) {
+	f, err := ioutil.TempFile("", "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(f, "line %v\n", i)
+	}
+	f.Close()
+	lines := func(res *model.ReadResponse) []string {
+		out := make([]string, 0, len(res.Lines))
+		for _, l := range res.Lines {
+			out = append(out, fmt.Sprintf("%v:%v", l.LineNumber, l.Line))
+		}
+		return out
+	}
+
+	res, err := Read(&model.ReadRequest{Log: f.Name(), Line: 9, Lines: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"9:line 9", "10:line 10"}; !reflect.DeepEqual(lines(res), want) || !res.EOF || res.BOF {
+		t.Fatalf("expected %v at eof, got %v", want, res)
+	}
+	//backward from middle of line 3, line numbers are known once start of file is reached
+	res, err = Read(&model.ReadRequest{Log: f.Name(), Offset: 16, Backward: true, Lines: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1:line 1", "2:line 2"}; !reflect.DeepEqual(lines(res), want) || !res.BOF || res.End != 14 {
+		t.Fatalf("expected %v, got %+v", want, res)
+	}
+	//last lines of log
+	res, err = Read(&model.ReadRequest{Log: f.Name(), Backward: true, Lines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0:line 9", "0:line 10"}; !reflect.DeepEqual(lines(res), want) || res.Start != 56 {
+		t.Fatalf("expected %v, got %+v", want, res)
+	}
+	//forward from offset with known line number
+	res, err = Read(&model.ReadRequest{Log: f.Name(), Offset: res.Start, Line: 9, Lines: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"9:line 9"}; !reflect.DeepEqual(lines(res), want) || res.End != 63 {
+		t.Fatalf("expected %v, got %+v", want, res)
+	}
+	if _, err = Read(&model.ReadRequest{Log: f.Name(), Line: 12}); err == nil {
+		t.Fatal("expected error for line beyond end of file")
+	}
+}
+
+func TestGzipReaderAt(t *testing.T) {
+	defer func(size int64, window int) { reverseBlockSize, gzipWindow = size, window }(reverseBlockSize, gzipWindow)
+	reverseBlockSize, gzipWindow = 50, 200
+	f, err := ioutil.TempFile("", "gzip-*.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	var content bytes.Buffer
+	for i := 1; i <= 200; i++ {
+		fmt.Fprintf(&content, "line %v\n", i)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write(content.Bytes())
+	gz.Close()
+	f.Close()
+
+	r, size, closer, err := openReaderAt(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	g := r.(*gzipReaderAt)
+	if size != int64(content.Len()) {
+		t.Fatalf("expected size %v, got %v", content.Len(), size)
+	}
+	//backwards, forwards and across the window
+	for _, off := range []int64{size - 30, 1000, 10, 500, 0, size - 300} {
+		b := make([]byte, 300)
+		n, err := r.ReadAt(b, off)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if want := content.Bytes()[off : off+int64(n)]; n == 0 || !bytes.Equal(b[:n], want) {
+			t.Errorf("expected %q at %v, got %q", want, off, b[:n])
+		}
+		if len(g.buf) > 2*gzipWindow {
+			t.Errorf("expected at most %v buffered bytes, got %v", 2*gzipWindow, len(g.buf))
+		}
+	}
+
+	res, err := Read(&model.ReadRequest{Log: f.Name(), Backward: true, Lines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lines) != 2 || res.Lines[1].Line != "line 200" {
+		t.Errorf("expected last lines of compressed log, got %+v", res.Lines)
+	}
+}
+
+func TestGrepReverseHistory(t *testing.T) {
+	defer func(size int64, window int) { reverseBlockSize, gzipWindow = size, window }(reverseBlockSize, gzipWindow)
+	reverseBlockSize, gzipWindow = 50, 100
+	dir, err := ioutil.TempDir("", "reverse-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	write := func(name string, from int, to int, age time.Duration) {
+		var content bytes.Buffer
+		for i := from; i <= to; i++ {
+			fmt.Fprintf(&content, "line %v\n", i)
+			if i%10 == 0 {
+				fmt.Fprintf(&content, "hit %v\n", i)
+			}
+		}
+		b := content.Bytes()
+		if strings.HasSuffix(name, ".gz") {
+			var gz bytes.Buffer
+			w := gzip.NewWriter(&gz)
+			w.Write(b)
+			w.Close()
+			b = gz.Bytes()
+		}
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, now.Add(-age), now.Add(-age))
+	}
+	write("app.log.2.gz", 1, 100, 2*time.Hour)
+	write("app.log.1", 101, 120, time.Hour)
+	write("app.log", 121, 140, 0)
+
+	req := &model.GrepRequest{Value: "hit", Logs: []string{filepath.Join(dir, "app.log")}, History: true, Reverse: true}
+	res, err := Grep(context.Background(), req, log.PrintLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Error != "" {
+		t.Fatal(res[0].Error)
+	}
+	found := make([]string, 0, 14)
+	for _, m := range res[0].Lines {
+		found = append(found, m.Line)
+	}
+	expected := make([]string, 0, 14)
+	for i := 140; i >= 10; i -= 10 {
+		expected = append(expected, fmt.Sprintf("hit %v", i))
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected newest first %v, got %v", expected, found)
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	f, err := ioutil.TempFile("", "tail-lines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`2021-05-06 11:27:58|ERROR|first
+2021-05-06 11:27:59|ERROR|failed
+java.lang.NullPointerException: null
+	at com.app.Service.run(Service.java:42)
+
+2021-05-06 11:28:00|INFO|` + strings.Repeat("x", 20*1024) + `
+2021-05-06 11:28:01|INFO|last`)
+	f.Close()
+	ls := &model.LogStructure{DateFormat: "2006-01-02 15:04:05"}
+
+	res, err := Tail(&model.LogRequest{Log: f.Name(), Lines: 3, LogStructure: ls})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lines) != 5 || res.Lines[0] != "2021-05-06 11:27:59|ERROR|failed" || res.Lines[4] != "2021-05-06 11:28:01|INFO|last" {
+		t.Fatalf("expected 3 records with stack trace, got %v lines", len(res.Lines))
+	}
+	//long record exceeds max bytes
+	res, err = Tail(&model.LogRequest{Log: f.Name(), Lines: 3, MaxBytes: 1024, LogStructure: ls})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lines) != 1 {
+		t.Fatalf("expected only last record within max bytes, got %v", len(res.Lines))
+	}
+	//without log structure lines are records
+	res, _, err = TailLogIfNewer(&model.LogRequest{Log: f.Name(), Lines: 2, Filter: &model.TailFilter{Value: "error"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Lines) != 2 || len(res.Highlights) != 2 || res.Lines[0] != "2021-05-06 11:27:58|ERROR|first" {
+		t.Fatalf("expected 2 error lines, got %v", res.Lines)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(log, []byte("a|INFO|one\nb|ERROR|two\nc|INFO|par"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	follower, res, err := NewFollower(&model.LogRequest{Log: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+	if len(res.Lines) != 2 || res.Offset != 23 {
+		t.Fatalf("expected 2 complete lines up to 23, got %v at %v", res.Lines, res.Offset)
+	}
+	next := func() *model.TailLogResponse {
+		res, err := follower.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res = next(); res != nil {
+		t.Fatalf("expected nothing until line is complete, got %v", res.Lines)
+	}
+	f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("tial\nd|INFO|four\n")
+	f.Close()
+	if res = next(); res == nil || !reflect.DeepEqual(res.Lines, []string{"c|INFO|partial", "d|INFO|four"}) || res.Event != "" {
+		t.Fatalf("expected appended lines, got %+v", res)
+	}
+	if err = os.Truncate(log, 0); err != nil {
+		t.Fatal(err)
+	}
+	if res = next(); res == nil || res.Event != model.TailEventTruncated || len(res.Lines) != 0 {
+		t.Fatalf("expected truncated event, got %+v", res)
+	}
+	f, _ = os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("d|INFO|before rotation\nd|INFO|last")
+	f.Close()
+	if err = os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(log, []byte("e|INFO|five\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res = next(); res == nil || res.Event != "" || !reflect.DeepEqual(res.Lines, []string{"d|INFO|before rotation", "d|INFO|last"}) {
+		t.Fatalf("expected lines of replaced log first, got %+v", res)
+	}
+	if res = next(); res == nil || res.Event != model.TailEventRotated || !reflect.DeepEqual(res.Lines, []string{"e|INFO|five"}) {
+		t.Fatalf("expected rotated event with new lines, got %+v", res)
+	}
+}
+
+func TestHub(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(path, []byte("a|INFO|one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub(log.PrintLogger(false))
+	ctx := context.Background()
+	all, res, err := hub.Subscribe(ctx, &model.LogRequest{Log: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+	if len(res.Lines) != 1 {
+		t.Fatalf("expected tailed line, got %v", res.Lines)
+	}
+	errors, _, err := hub.Subscribe(ctx, &model.LogRequest{Log: path, Filter: &model.TailFilter{Value: "ERROR"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hub.feeds) != 1 {
+		t.Fatalf("expected subscribers to share feed, got %v", len(hub.feeds))
+	}
+	next := func(s *Subscription) *model.TailLogResponse {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		res, err := s.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("b|INFO|two\nc|ERROR|three\n")
+	f.Close()
+	if res = next(all); !reflect.DeepEqual(res.Lines, []string{"b|INFO|two", "c|ERROR|three"}) {
+		t.Fatalf("expected appended lines, got %v", res.Lines)
+	}
+	if res = next(errors); !reflect.DeepEqual(res.Lines, []string{"c|ERROR|three"}) {
+		t.Fatalf("expected filtered lines, got %v", res.Lines)
+	}
+	errors.Close()
+
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path, []byte("d|INFO|four\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res = next(all); res.Event != model.TailEventRotated || !reflect.DeepEqual(res.Lines, []string{"d|INFO|four"}) {
+		t.Fatalf("expected rotated event with new lines, got %+v", res)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err = all.Next(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected idle subscription to time out, got %v", err)
+	}
+	all.Close()
+	if len(hub.feeds) != 0 {
+		t.Fatalf("expected feed to stop with last subscriber")
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(path, []byte("a|INFO|one\nb|ERROR|two\nc|INFO|three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub(log.PrintLogger(false))
+	defer func(n int64) { followMaxBytes = n }(followMaxBytes)
+	followMaxBytes = 13
+	sub, res, err := hub.Resume(context.Background(), &model.LogRequest{Log: path}, "", 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if !reflect.DeepEqual(res.Lines, []string{"b|ERROR|two"}) || res.Offset != 23 {
+		t.Fatalf("expected first part of backlog, got %v at %v", res.Lines, res.Offset)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if res, err = sub.Next(ctx); err != nil || !reflect.DeepEqual(res.Lines, []string{"c|INFO|three"}) || res.Offset != 36 {
+		t.Fatalf("expected rest of backlog, got %+v %v", res, err)
+	}
+
+	truncated, res, err := hub.Resume(context.Background(), &model.LogRequest{Log: path}, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer truncated.Close()
+	if res.Event != model.TailEventTruncated || !reflect.DeepEqual(res.Lines, []string{"a|INFO|one"}) {
+		t.Fatalf("expected log read from start, got %+v", res)
+	}
+
+	file := sub.File()
+	if file == "" {
+		t.Skip("file identity is not available")
+	}
+	os.Rename(path, path+".1")
+	if err = ioutil.WriteFile(path, []byte("d|INFO|four\ne|INFO|five\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rotated, res, err := hub.Resume(context.Background(), &model.LogRequest{Log: path}, file, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rotated.Close()
+	if res.Event != model.TailEventRotated || !reflect.DeepEqual(res.Lines, []string{"d|INFO|four"}) || rotated.File() == file {
+		t.Fatalf("expected new log read from start, got %+v", res)
+	}
+}
+
+func TestTailFieldFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(path, []byte(`2021-05-06 11:27:58,453|exec-1|INFO|LogFilter|ab12345|req-1|start
+2021-05-06 11:27:58,455|exec-1|ERROR|AppExceptionHandler|ab12345|req-1|failed
+java.lang.NullPointerException: null
+2021-05-06 11:27:58,456|exec-2|ERROR|AppExceptionHandler|cd67890|req-2|failed too
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ls := &model.LogStructure{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6, DateFormat: "2006-01-02 15:04:05"}
+	req := &model.LogRequest{Log: path, LogStructure: ls, Filter: &model.TailFilter{Level: "error", User: "AB12345"}}
+	follower, res, err := NewFollower(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+	if len(res.Lines) != 2 || !strings.Contains(res.Lines[1], "NullPointerException") {
+		t.Fatalf("expected error record of user with stack trace, got %v", res.Lines)
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("\tat com.app.Service.run(Service.java:42)\n2021-05-06 11:27:59,001|exec-1|ERROR|Job|ab12345|req-3|retry\n")
+	f.Close()
+	info, _ := os.Stat(path)
+	if res, err = follower.Next(); err != nil || len(res.Lines) != 1 || !strings.HasSuffix(res.Lines[0], "retry") || res.Offset != info.Size() {
+		t.Fatalf("expected only new matching record, got %+v %v", res, err)
+	}
+
+	req.Filter = &model.TailFilter{Value: "NullPointer"}
+	if res, err = Tail(req); err != nil || len(res.Lines) != 2 || len(res.Highlights) != 2 || len(res.Highlights[1]) != 1 {
+		t.Fatalf("expected record with message matching, got %+v %v", res, err)
+	}
+	if _, err = Tail(&model.LogRequest{Log: path, Filter: &model.TailFilter{Level: "ERROR"}}); err == nil {
+		t.Fatal("expected level filter without log structure to fail")
+	}
+
+	//only hits in message are highlighted
+	line := "2021-05-06 11:27:59,002|exec-1|ERROR|Job|ab12345|req-4|job of ab12345 failed"
+	if err = ioutil.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req.Filter = &model.TailFilter{Value: "ab12345"}
+	start := strings.LastIndex(line, "ab12345")
+	want := [][]model.Highlight{{{Start: start, End: start + 7, ByteStart: start, ByteEnd: start + 7}}}
+	if res, err = Tail(req); err != nil || !reflect.DeepEqual(res.Highlights, want) {
+		t.Fatalf("expected highlight in message %v, got %+v %v", want, res, err)
+	}
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err = ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(n int) { feedCacheChunks = n }(feedCacheChunks)
+	feedCacheChunks = 2
+	hub := NewHub(log.PrintLogger(false))
+	slow, _, err := hub.Subscribe(context.Background(), &model.LogRequest{Log: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, _, err := hub.Subscribe(context.Background(), &model.LogRequest{Log: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+	expected := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		line := fmt.Sprintf("line %v", i)
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(line + "\n")
+		f.Close()
+		expected = append(expected, line)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		res, err := fast.Next(ctx)
+		cancel()
+		if err != nil || res.Lines[0] != line {
+			t.Fatalf("expected %v, got %+v %v", line, res, err)
+		}
+	}
+	lines := make([]string, 0, 5)
+	for len(lines) < 5 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		res, err := slow.Next(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("expected lines behind cache from disk, got %v after %v", err, lines)
+		}
+		lines = append(lines, res.Lines...)
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestDetectStructure(t *testing.T) {
+	res, err := DetectStructure(&model.DetectRequest{Log: "../test-logs/java-app.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &model.LogStructure{Date: 0, Level: 2, User: 4, Reqid: 5, Message: 6, DateFormat: "2006-01-02 15:04:05,000"}
+	if !reflect.DeepEqual(res.LogStructure, want) || res.Confidence["date"] < 0.9 || res.Confidence["level"] < 0.9 {
+		t.Fatalf("expected %+v, got %+v %v", want, res.LogStructure, res.Confidence)
+	}
+
+	dir, err := ioutil.TempDir("", "detect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name string
+		log  string
+		want *model.LogStructure
+	}{
+		{"json", `{"ts":"2021-05-06T11:27:58Z","severity":"info","message":"started","request_id":"a1b2c3d4e5"}
+{"ts":"2021-05-06T11:27:59Z","severity":"error","message":"failed","request_id":"f6a7b8c9d0"}
+`, &model.LogStructure{Format: model.FormatJSON, DateFormat: "2006-01-02T15:04:05Z07:00",
+			Fields: map[string]string{"date": "ts", "level": "severity", "message": "message", "reqid": "request_id"}}},
+		{"logfmt", `time=2021-05-06T11:27:58Z level=info user=ab12345 msg="user logged in"
+time=2021-05-06T11:27:59Z level=warn user=cd67890 msg="disk almost full"
+`, &model.LogStructure{Format: model.FormatLogfmt, DateFormat: "2006-01-02T15:04:05Z07:00",
+			Fields: map[string]string{"date": "time", "level": "level", "message": "msg", "user": "user"}}},
+		{"tabs", "2021-05-06 11:27:58\tINFO\tstarted app\n2021-05-06 11:27:59\tWARN\tdisk almost full\n",
+			&model.LogStructure{Date: 0, Level: 1, User: -1, Reqid: -1, Message: 2, Delimiter: "\t", DateFormat: "2006-01-02 15:04:05"}},
+		{"padded", "2021-05-06 11:27:58.001 [main] INFO  App - started\n2021-05-06 11:27:59.002 [pool-1] ERROR App - failed\n\tat App.run\n",
+			&model.LogStructure{Format: model.FormatRegex, DateFormat: "2006-01-02 15:04:05.000",
+				Pattern: `^(?P<date>\S+\s+\S+)\s+\S+\s+(?P<level>\S+)\s+(?P<message>.*)$`}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".log")
+		if err = ioutil.WriteFile(path, []byte(tt.log), 0644); err != nil {
+			t.Fatal(err)
+		}
+		res, err := DetectStructure(&model.DetectRequest{Log: path})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(res.LogStructure, tt.want) {
+			t.Errorf("%v: expected %+v, got %+v", tt.name, tt.want, res.LogStructure)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"context"
+
+	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//GrepStream greps logs emitting matches as they are found together with scan progress,
+//scanning stops when ctx is done or emit fails
+func GrepStream(ctx context.Context, req *model.GrepRequest, logger l.Logger, emit func(*model.GrepEvent) error) error {
+	m, err := newRequestMatcher(req)
+	if err != nil {
+		return err
+	}
+	var emitErr error
+	for _, log := range req.Logs {
+		logger.Info(ctx, "Local streamed grep for %v - '%v'", log, req.Value)
+		l := log
+		job := &grepJob{ctx: ctx, log: l, m: m, req: req, onMatch: func(match model.GrepMatch) error {
+			emitErr = emit(&model.GrepEvent{Type: model.GrepEventMatch, LogFile: l, Match: &match})
+			return emitErr
+		}, onProgress: func(scanned int64, total int64) error {
+			emitErr = emit(&model.GrepEvent{Type: model.GrepEventProgress, LogFile: l, Scanned: scanned, Total: total})
+			return emitErr
+		}}
+		cursor, err := job.run()
+		if emitErr != nil {
+			return emitErr
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Error(ctx, "Could not grep %v, %v", l, err)
+			if emitErr = emit(&model.GrepEvent{Type: model.GrepEventError, LogFile: l, Error: err.Error()}); emitErr != nil {
+				return emitErr
+			}
+		}
+		if cursor != "" {
+			if emitErr = emit(&model.GrepEvent{Type: model.GrepEventCursor, LogFile: l, Cursor: cursor}); emitErr != nil {
+				return emitErr
+			}
+		}
+	}
+	return emit(&model.GrepEvent{Type: model.GrepEventDone})
+}
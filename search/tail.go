@@ -0,0 +1,89 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/RomanLorens/logviewer-module/model"
+)
+
+//tailMaxLines max records tailed by line count
+var tailMaxLines = 10000
+
+//tailMaxBytes bytes read at most when tailing line count without MaxBytes
+var tailMaxBytes int64 = 16 * 1024 * 1024
+
+//tailRecords reads log backwards block by block, with history its rotations too, until it has
+//req.Lines complete records matching filter or MaxBytes was read, complete leaves out last line
+//of log not terminated yet
+func tailRecords(req *model.LogRequest, m Matcher, complete bool, res *model.TailLogResponse) error {
+	n := req.Lines
+	if n > tailMaxLines {
+		n = tailMaxLines
+	}
+	budget := req.MaxBytes
+	if budget <= 0 {
+		budget = tailMaxBytes
+	}
+	start, err := recordStart(req.LogStructure)
+	if err != nil {
+		return err
+	}
+	files, err := LogFiles(req.Log, req.History)
+	if err != nil {
+		return err
+	}
+	//newest first
+	records := make([]string, 0, n)
+	for i := len(files) - 1; i >= 0 && len(records) < n && budget > 0; i-- {
+		r, size, closer, err := openReaderAt(files[i])
+		if err != nil {
+			return fmt.Errorf("Could not open %v, %v", files[i], err)
+		}
+		end := size
+		if i == len(files)-1 {
+			if complete && size > 0 {
+				if end, err = lineStart(r, size); err != nil {
+					closer.Close()
+					return fmt.Errorf("Could not read %v, %v", files[i], err)
+				}
+			}
+			res.Offset = end
+		}
+		s := &ReverseRecordScanner{lines: newLineReader(r, end), start: start, ls: req.LogStructure}
+		for len(records) < n && s.scan() {
+			budget -= int64(len(s.record.Text)) + 1
+			if budget < 0 {
+				break
+			}
+			rec := NormalizeText(s.record.Text)
+			if strings.TrimSpace(rec) == "" || (m != nil && !m.Match(rec)) {
+				continue
+			}
+			records = append(records, rec)
+		}
+		err = s.Err()
+		closer.Close()
+		if err != nil {
+			return fmt.Errorf("Could not read %v, %v", files[i], err)
+		}
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		for _, l := range strings.Split(records[i], "\n") {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			res.Lines = append(res.Lines, l)
+			if m != nil {
+				res.Highlights = append(res.Highlights, Highlights(l, m.Find(l)))
+			}
+		}
+	}
+	return nil
+}
+
+//completeLines length of data up to and including its last new line
+func completeLines(data []byte) int {
+	return bytes.LastIndexByte(data, '\n') + 1
+}
@@ -0,0 +1,253 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+)
+
+//seekPrecision binary search stops when window is smaller, rest is scanned
+const seekPrecision = 64 * 1024
+
+//seekMaxLines lines read from probe offset to find parsable timestamp
+const seekMaxLines = 100
+
+//TimeRange [From, To) window, zero bound is open
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+//NewTimeRange time range from epoch millis, 0 means open bound
+func NewTimeRange(from int64, to int64) TimeRange {
+	var tr TimeRange
+	if from > 0 {
+		tr.From = time.Unix(0, from*int64(time.Millisecond))
+	}
+	if to > 0 {
+		tr.To = time.Unix(0, to*int64(time.Millisecond))
+	}
+	return tr
+}
+
+//IsSet true when any bound is set
+func (tr TimeRange) IsSet() bool {
+	return !tr.From.IsZero() || !tr.To.IsZero()
+}
+
+//Contains true when t is in [From, To)
+func (tr TimeRange) Contains(t time.Time) bool {
+	if !tr.From.IsZero() && t.Before(tr.From) {
+		return false
+	}
+	if !tr.To.IsZero() && !t.Before(tr.To) {
+		return false
+	}
+	return true
+}
+
+//After true when t is at or after upper bound
+func (tr TimeRange) After(t time.Time) bool {
+	return !tr.To.IsZero() && !t.Before(tr.To)
+}
+
+//DateLayout go time layout from LogStructure, DateFormat wins over JavaDateFormat
+func DateLayout(ls *model.LogStructure) string {
+	if ls == nil {
+		return ""
+	}
+	if ls.DateFormat != "" {
+		return ls.DateFormat
+	}
+	return JavaDateLayout(ls.JavaDateFormat)
+}
+
+//javaLayouts java SimpleDateFormat letters to go layout, longest first
+var javaLayouts = []struct {
+	java   string
+	layout string
+}{
+	{"yyyy", "2006"}, {"yy", "06"},
+	{"MMMM", "January"}, {"MMM", "Jan"}, {"MM", "01"}, {"M", "1"},
+	{"dd", "02"}, {"d", "2"},
+	{"EEEE", "Monday"}, {"EEE", "Mon"}, {"E", "Mon"},
+	{"HH", "15"}, {"H", "15"},
+	{"hh", "03"}, {"h", "3"},
+	{"mm", "04"}, {"m", "4"},
+	{"ss", "05"}, {"s", "5"},
+	{"SSSSSS", "000000"}, {"SSS", "000"}, {"SS", "00"}, {"S", "0"},
+	{"a", "PM"},
+	{"XXX", "-07:00"}, {"XX", "-0700"}, {"X", "-07"},
+	{"Z", "-0700"}, {"z", "MST"},
+}
+
+//JavaDateLayout converts java date pattern e.g. yyyy-MM-dd HH:mm:ss,SSS to go layout
+func JavaDateLayout(java string) string {
+	var sb strings.Builder
+	for i := 0; i < len(java); {
+		if java[i] == '\'' {
+			end := strings.IndexByte(java[i+1:], '\'')
+			if end < 0 {
+				sb.WriteString(java[i+1:])
+				break
+			}
+			if end == 0 {
+				sb.WriteByte('\'')
+			}
+			sb.WriteString(java[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+		matched := false
+		for _, jl := range javaLayouts {
+			if strings.HasPrefix(java[i:], jl.java) {
+				sb.WriteString(jl.layout)
+				i += len(jl.java)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			sb.WriteByte(java[i])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+//ParseTime parses log date value with layout from LogStructure, trailing text after date is ignored
+func ParseTime(value string, ls *model.LogStructure) (time.Time, error) {
+	layout := DateLayout(ls)
+	if layout == "" {
+		return time.Time{}, fmt.Errorf("Missing date format in log structure")
+	}
+	value = strings.TrimSpace(value)
+	t, err := parseTime(layout, value)
+	if err == nil {
+		return t, nil
+	}
+	//date followed by other text, try the layout wide prefix and then prefixes ending before a space
+	if len(value) > len(layout) {
+		if t, er := parseTime(layout, value[:len(layout)]); er == nil {
+			return t, nil
+		}
+	}
+	for i := len(value) - 1; i > 0; i-- {
+		if value[i] != ' ' {
+			continue
+		}
+		if t, er := parseTime(layout, value[:i]); er == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Could not parse date '%v' with layout '%v', %v", value, layout, err)
+}
+
+func parseTime(layout string, value string) (time.Time, error) {
+	//comma as fractional seconds separator is not understood by older go versions
+	if i := strings.Index(layout, "05,0"); i >= 0 && len(value) > i+2 && value[i+2] == ',' {
+		layout = layout[:i+2] + "." + layout[i+3:]
+		value = value[:i+2] + "." + value[i+3:]
+	}
+	return time.ParseInLocation(layout, value, time.Local)
+}
+
+//RecordTime parses timestamp of record, scanners resolve parser once and use recordTime
+func RecordTime(rec *Record, ls *model.LogStructure) (time.Time, error) {
+	if ls == nil {
+		return time.Time{}, fmt.Errorf("Missing log structure")
+	}
+	p, err := parser.Of(ls)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return recordTime(rec.FirstLine(), p, ls)
+}
+
+//recordTime parses timestamp of first line of record with parser of its log structure
+func recordTime(line string, p parser.Parser, ls *model.LogStructure) (time.Time, error) {
+	if p == nil {
+		return time.Time{}, fmt.Errorf("Missing log structure")
+	}
+	r, ok := p.Parse(line)
+	if !ok || r.Date == "" {
+		return time.Time{}, fmt.Errorf("Missing date in '%v'", line)
+	}
+	return ParseTime(r.Date, ls)
+}
+
+//seekTime binary searches sorted log for window [lo, hi), records before lo are older than t,
+//records starting after hi are at or after t
+func seekTime(r io.ReaderAt, size int64, ls *model.LogStructure, t time.Time) (int64, int64, error) {
+	p, err := parser.Of(ls)
+	if err != nil {
+		return 0, 0, err
+	}
+	lo, hi := int64(0), size
+	for hi-lo > seekPrecision {
+		mid := lo + (hi-lo)/2
+		pt, _, ok, err := probeTime(r, mid, size, p, ls)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !ok || !pt.Before(t) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return lo, hi, nil
+}
+
+//probeTime finds first parsable timestamp of a line starting after offset, returns the line offset
+func probeTime(r io.ReaderAt, offset int64, size int64, p parser.Parser, ls *model.LogStructure) (time.Time, int64, bool, error) {
+	reader := bufio.NewReader(io.NewSectionReader(r, offset, size-offset))
+	pos := offset
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return time.Time{}, 0, false, nil
+			}
+			return time.Time{}, 0, false, err
+		}
+		pos += int64(len(skipped))
+	}
+	for i := 0; i < seekMaxLines; i++ {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if t, er := recordTime(strings.TrimRight(line, "\r\n"), p, ls); er == nil {
+				return t, pos, true, nil
+			}
+		}
+		pos += int64(len(line))
+		if err == io.EOF {
+			return time.Time{}, 0, false, nil
+		}
+		if err != nil {
+			return time.Time{}, 0, false, err
+		}
+	}
+	return time.Time{}, 0, false, nil
+}
+
+//recordAfter offset of first record with parsable timestamp starting after offset, size when none
+func recordAfter(r io.ReaderAt, offset int64, size int64, ls *model.LogStructure) int64 {
+	if offset >= size {
+		return size
+	}
+	p, err := parser.Of(ls)
+	if err != nil {
+		return size
+	}
+	_, pos, ok, err := probeTime(r, offset, size, p, ls)
+	if err != nil || !ok {
+		return size
+	}
+	return pos
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/RomanLorens/logger/log"
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+	"github.com/RomanLorens/logviewer-module/utils"
+)
+
+//Trace finds records of request id in logs, each with its own structure, and merges them
+//into timeline ordered by record time
+func Trace(ctx context.Context, req *model.TraceRequest, logger l.Logger) (*model.TraceResponse, error) {
+	reqid := strings.TrimSpace(req.ReqID)
+	if reqid == "" {
+		return nil, fmt.Errorf("Missing reqid to trace")
+	}
+	host, err := utils.Hostname()
+	if err != nil {
+		logger.Error(ctx, "Could not resolve hostname, %v", err)
+	}
+	res := &model.TraceResponse{ReqID: reqid, Host: host, Steps: make([]model.TraceStep, 0, 20)}
+	perLog := make([][]model.TraceStep, len(req.Logs))
+	errs := make([]error, len(req.Logs))
+	var wg sync.WaitGroup
+	sem := make(chan bool, grepWorkers)
+	for i := range req.Logs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer utils.CatchError(ctx, logger)
+			sem <- true
+			defer func() { <-sem }()
+			perLog[i], errs[i] = traceLog(ctx, reqid, req.Logs[i], req)
+		}(i)
+	}
+	wg.Wait()
+	for i, tl := range req.Logs {
+		if errs[i] != nil {
+			logger.Error(ctx, "Could not trace %v in %v, %v", reqid, tl.Log, errs[i])
+			if res.Errors == nil {
+				res.Errors = make(map[string]string)
+			}
+			res.Errors[tl.Log] = errs[i].Error()
+			continue
+		}
+		res.Steps = append(res.Steps, perLog[i]...)
+	}
+	timeline(res)
+	return res, nil
+}
+
+func traceLog(ctx context.Context, reqid string, tl model.TraceLog, req *model.TraceRequest) ([]model.TraceStep, error) {
+	if tl.LogStructure == nil {
+		return nil, fmt.Errorf("Missing log structure")
+	}
+	gr := &model.GrepRequest{Value: reqid, Field: model.FieldReqID, CaseSensitive: true, LogStructure: tl.LogStructure,
+		FromTime: req.FromTime, ToTime: req.ToTime, History: req.History}
+	m, err := newRequestMatcher(gr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parser.Of(tl.LogStructure)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]model.TraceStep, 0, 10)
+	job := &grepJob{ctx: ctx, log: tl.Log, m: m, req: gr, onMatch: func(match model.GrepMatch) error {
+		step := model.TraceStep{GrepLine: match.GrepLine, Log: tl.Log}
+		if t, err := recordTime(Record{Text: match.Line}.FirstLine(), p, tl.LogStructure); err == nil {
+			step.Time = t.UnixNano() / int64(time.Millisecond)
+		}
+		steps = append(steps, step)
+		return nil
+	}}
+	if _, err = job.run(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+//timeline orders steps by time, keeping order of log and file for equal times,
+//and sets durations between them
+func timeline(res *model.TraceResponse) {
+	sort.SliceStable(res.Steps, func(i int, j int) bool {
+		a, b := res.Steps[i], res.Steps[j]
+		if a.Time == 0 || b.Time == 0 {
+			return a.Time != 0
+		}
+		return a.Time < b.Time
+	})
+	var first, prev int64
+	for i := range res.Steps {
+		s := &res.Steps[i]
+		if s.Time == 0 {
+			break
+		}
+		if first == 0 {
+			first, prev = s.Time, s.Time
+		}
+		s.Elapsed = s.Time - prev
+		s.SinceStart = s.Time - first
+		prev = s.Time
+	}
+	if prev > 0 {
+		res.Duration = prev - first
+	}
+}
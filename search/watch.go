@@ -0,0 +1,64 @@
+package search
+
+import (
+	"os"
+	"time"
+)
+
+//pollInterval interval of polling watcher used when file notifications are not available
+var pollInterval = 500 * time.Millisecond
+
+//watcher signals possible changes of watched file
+type watcher interface {
+	events() <-chan struct{}
+	close()
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+//pollWatcher signals when size, modification time or identity of file changed
+type pollWatcher struct {
+	c    chan struct{}
+	done chan struct{}
+}
+
+func newPollWatcher(path string) *pollWatcher {
+	w := &pollWatcher{c: make(chan struct{}, 1), done: make(chan struct{})}
+	go w.poll(path)
+	return w
+}
+
+func (w *pollWatcher) poll(path string) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var last os.FileInfo
+	for {
+		select {
+		case <-w.done:
+			close(w.c)
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if last == nil || info.Size() != last.Size() || !info.ModTime().Equal(last.ModTime()) || fileID(info) != fileID(last) {
+			notify(w.c)
+		}
+		last = info
+	}
+}
+
+func (w *pollWatcher) events() <-chan struct{} {
+	return w.c
+}
+
+func (w *pollWatcher) close() {
+	close(w.done)
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+//inotifyWatcher watches directory of file to notice writes as well as rotation
+type inotifyWatcher struct {
+	f    *os.File
+	name string
+	c    chan struct{}
+}
+
+//newWatcher inotify watcher, polling when inotify is not available
+func newWatcher(path string) watcher {
+	w, err := newInotifyWatcher(path)
+	if err != nil {
+		return newPollWatcher(path)
+	}
+	return w
+}
+
+func newInotifyWatcher(path string) (*inotifyWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	mask := uint32(syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB)
+	if _, err = syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	//non blocking fd is served by runtime poller, close unblocks read
+	w := &inotifyWatcher{f: os.NewFile(uintptr(fd), "inotify"), name: filepath.Base(path), c: make(chan struct{}, 1)}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) read() {
+	defer close(w.c)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			name := bytes.TrimRight(buf[start:start+int(ev.Len)], "\x00")
+			if string(name) == w.name {
+				notify(w.c)
+			}
+			off = start + int(ev.Len)
+		}
+	}
+}
+
+func (w *inotifyWatcher) events() <-chan struct{} {
+	return w.c
+}
+
+func (w *inotifyWatcher) close() {
+	w.f.Close()
+}
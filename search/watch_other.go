@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package search
+
+//newWatcher polling watcher, file notifications are used on linux only
+func newWatcher(path string) watcher {
+	return newPollWatcher(path)
+}
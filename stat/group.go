@@ -0,0 +1,237 @@
+package stat
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+	"github.com/RomanLorens/logviewer-module/search"
+)
+
+//defaultGroupsSize groups per page when size is not set
+const defaultGroupsSize = 20
+
+//maxGroupUsers users listed per group
+var maxGroupUsers = 50
+
+//maxFrames top stack frames of fingerprint
+var maxFrames = 5
+
+//trendBuckets parts of trend of group
+var trendBuckets = 24
+
+//normalizers replace variable parts of messages, applied in order
+var normalizers = []struct {
+	re   *regexp.Regexp
+	repl func(string) string
+}{
+	{regexp.MustCompile(`\?[^\s"'<>{}]+`), literal("?<query>")},
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), literal("<uuid>")},
+	{regexp.MustCompile(`\b0[xX][0-9a-fA-F]+\b`), literal("<hex>")},
+	//hash or id has to have digit and letter to tell it from word and number
+	{regexp.MustCompile(`\b[0-9a-fA-F]{6,}\b`), func(t string) string {
+		if strings.IndexAny(t, "0123456789") >= 0 && strings.IndexAny(t, "abcdefABCDEF") >= 0 {
+			return "<hex>"
+		}
+		return t
+	}},
+	{regexp.MustCompile(`\d+`), literal("<n>")},
+	{regexp.MustCompile(`\s+`), literal(" ")},
+}
+
+func literal(repl string) func(string) string {
+	return func(string) string { return repl }
+}
+
+var (
+	frame    = regexp.MustCompile(`^\s*at\s+([^\s(]+)`)
+	causedBy = regexp.MustCompile(`^\s*Caused by:\s*([\w$.]+)`)
+)
+
+//group errors of fingerprint, trend counts records per minute until time span of all groups is known
+type group struct {
+	model.ErrorGroup
+	users   map[string]bool
+	minutes map[int64]int
+}
+
+//ErrorGroups groups errors and warnings by fingerprint of normalized message and top stack frames
+func ErrorGroups(req *model.ErrorGroupsRequest) (*model.ErrorGroupsPagination, error) {
+	switch req.Sort {
+	case "", model.ErrorGroupsByCount, model.ErrorGroupsByUsers, model.ErrorGroupsByFirstSeen, model.ErrorGroupsByLastSeen:
+	default:
+		return nil, fmt.Errorf("Unknown sort %v of error groups", req.Sort)
+	}
+	if req.StatsRequest == nil {
+		return nil, fmt.Errorf("Missing log of error groups")
+	}
+	files, err := search.LogFiles(req.Log, req.History)
+	if err != nil {
+		return nil, err
+	}
+	ls := req.LogStructure
+	groups := make(map[string]*group)
+	var first, last time.Time
+	err = scanRecords(files, ls, search.NewTimeRange(req.FromTime, req.ToTime), func(rec *parser.Record) {
+		level := strings.ToUpper(search.NormalizeText(rec.Level))
+		if !(level == "ERROR" || level == "WARNING" || level == "WARN") {
+			return
+		}
+		msg, fp := fingerprint(level, rec)
+		g, ok := groups[fp]
+		if !ok {
+			sample, _ := firstLine(rec.Message)
+			g = &group{ErrorGroup: model.ErrorGroup{Fingerprint: fp, Level: level, Message: msg, Sample: sample,
+				SampleReqID: rec.ReqID, FirstSeen: rec.Date}, users: make(map[string]bool), minutes: make(map[int64]int)}
+			groups[fp] = g
+		}
+		g.Count++
+		if user := strings.TrimSpace(rec.User); user != "" {
+			g.users[user] = true
+		}
+		t, err := search.ParseTime(rec.Date, ls)
+		if err != nil {
+			if g.LastTime == 0 {
+				g.LastSeen = rec.Date
+			}
+			return
+		}
+		ms := t.UnixNano() / int64(time.Millisecond)
+		if g.FirstTime == 0 || ms < g.FirstTime {
+			g.FirstTime, g.FirstSeen = ms, rec.Date
+		}
+		if ms >= g.LastTime {
+			g.LastTime, g.LastSeen = ms, rec.Date
+		}
+		g.minutes[ms/int64(time.Minute/time.Millisecond)]++
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]model.ErrorGroup, 0, len(groups))
+	for _, g := range groups {
+		g.UserCount = len(g.users)
+		g.Users = make([]string, 0, len(g.users))
+		for u := range g.users {
+			g.Users = append(g.Users, u)
+		}
+		sort.Strings(g.Users)
+		if len(g.Users) > maxGroupUsers {
+			g.Users = g.Users[:maxGroupUsers]
+		}
+		g.Trend = trend(g.minutes, first, last)
+		res = append(res, g.ErrorGroup)
+	}
+	sortGroups(res, req.Sort)
+
+	size := req.Size
+	if size <= 0 {
+		size = defaultGroupsSize
+	}
+	out := &model.ErrorGroupsPagination{Groups: []model.ErrorGroup{},
+		Pagination: &model.Pagination{From: req.From, Size: size, Total: len(res)}}
+	if !first.IsZero() {
+		out.TrendStart, out.TrendEnd = first.UnixNano()/int64(time.Millisecond), last.UnixNano()/int64(time.Millisecond)
+	}
+	start := req.From * size
+	end := start + size
+	if end >= len(res) {
+		end = len(res)
+	}
+	if start < end {
+		out.Groups = res[start:end]
+	}
+	return out, nil
+}
+
+//fingerprint normalized first line of message and fingerprint of level, normalized message and
+//top stack frames with causes
+func fingerprint(level string, rec *parser.Record) (string, string) {
+	line, rest := firstLine(rec.Message)
+	msg := normalize(line, rec.ReqID)
+	parts := []string{level, msg}
+	frames := 0
+	for _, l := range strings.Split(rest, "\n") {
+		if m := causedBy.FindStringSubmatch(l); m != nil {
+			parts = append(parts, "Caused by: "+m[1])
+			frames = 0
+			continue
+		}
+		if m := frame.FindStringSubmatch(l); m != nil && frames < maxFrames {
+			parts = append(parts, m[1])
+			frames++
+		}
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "\n")))
+	return msg, hex.EncodeToString(sum[:8])
+}
+
+//normalize replaces request id, query strings, uuids, hex values and numbers of message
+func normalize(msg string, reqid string) string {
+	if reqid = strings.TrimSpace(reqid); reqid != "" {
+		msg = strings.ReplaceAll(msg, reqid, "<reqid>")
+	}
+	for _, n := range normalizers {
+		msg = n.re.ReplaceAllStringFunc(msg, n.repl)
+	}
+	return strings.TrimSpace(msg)
+}
+
+func firstLine(msg string) (string, string) {
+	msg = strings.TrimLeft(msg, "\n")
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		return strings.TrimSpace(msg[:i]), msg[i+1:]
+	}
+	return strings.TrimSpace(msg), ""
+}
+
+//trend counts of minutes in trendBuckets equal parts of [first, last]
+func trend(minutes map[int64]int, first time.Time, last time.Time) []int {
+	t := make([]int, trendBuckets)
+	if first.IsZero() {
+		return t
+	}
+	from := first.Unix() / 60
+	span := last.Unix()/60 - from + 1
+	for m, c := range minutes {
+		t[int((m-from)*int64(trendBuckets)/span)] += c
+	}
+	return t
+}
+
+func sortGroups(groups []model.ErrorGroup, by string) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		switch by {
+		case model.ErrorGroupsByUsers:
+			if a.UserCount != b.UserCount {
+				return a.UserCount > b.UserCount
+			}
+		case model.ErrorGroupsByFirstSeen:
+			if a.FirstTime != b.FirstTime {
+				return a.FirstTime > b.FirstTime
+			}
+		case model.ErrorGroupsByLastSeen:
+			if a.LastTime != b.LastTime {
+				return a.LastTime > b.LastTime
+			}
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+}
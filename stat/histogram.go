@@ -0,0 +1,184 @@
+package stat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
+	"github.com/RomanLorens/logviewer-module/search"
+)
+
+//maxBuckets max buckets of histogram including empty ones
+var maxBuckets = 10000
+
+//intervals histogram intervals, shortest first
+var intervals = []string{model.HistogramMinute, model.Histogram5Minutes, model.HistogramHour, model.HistogramDay}
+
+//Histogram counts records of log per time bucket and level, buckets start at local time
+func Histogram(req *model.HistogramRequest) (*model.HistogramResponse, error) {
+	interval := req.Interval
+	if interval == "" {
+		interval = model.HistogramAuto
+	}
+	if interval != model.HistogramAuto && length(interval) == 0 {
+		return nil, fmt.Errorf("Unknown histogram interval %v", interval)
+	}
+	ls := req.LogStructure
+	if search.DateLayout(ls) == "" {
+		return nil, fmt.Errorf("Histogram requires log structure with date format")
+	}
+	files, err := search.LogFiles(req.Log, req.History)
+	if err != nil {
+		return nil, err
+	}
+	//auto interval counts per minute first, minutes are merged once time span is known
+	base := interval
+	if interval == model.HistogramAuto {
+		base = model.HistogramMinute
+	}
+	buckets := make(map[int64]*model.HistogramBucket)
+	unparsed := 0
+	err = scanRecords(files, ls, search.NewTimeRange(req.FromTime, req.ToTime), func(rec *parser.Record) {
+		t, err := search.ParseTime(rec.Date, ls)
+		if err != nil {
+			unparsed++
+			return
+		}
+		b := bucket(buckets, start(t, base))
+		b.Total++
+		if level := strings.ToUpper(search.NormalizeText(rec.Level)); level != "" {
+			b.Levels[level]++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if interval == model.HistogramAuto {
+		interval = autoInterval(buckets)
+		buckets = merge(buckets, interval)
+	}
+	res, err := fill(buckets, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &model.HistogramResponse{Log: req.Log, Interval: interval, Buckets: res, Unparsed: unparsed}, nil
+}
+
+//length of interval, day is nominal as days with DST change are shorter or longer
+func length(interval string) time.Duration {
+	switch interval {
+	case model.HistogramMinute:
+		return time.Minute
+	case model.Histogram5Minutes:
+		return 5 * time.Minute
+	case model.HistogramHour:
+		return time.Hour
+	case model.HistogramDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+//start start of bucket of t in local time, buckets shorter than day are truncated in absolute
+//time shifted by local offset at t so hour repeated by DST change has its own bucket
+func start(t time.Time, interval string) time.Time {
+	t = t.In(time.Local)
+	if interval == model.HistogramDay {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(length(interval)).Add(-shift)
+}
+
+//next start of bucket following bucket starting at t
+func next(t time.Time, interval string) time.Time {
+	if interval == model.HistogramDay {
+		return t.AddDate(0, 0, 1)
+	}
+	return start(t.Add(length(interval)), interval)
+}
+
+func bucket(buckets map[int64]*model.HistogramBucket, t time.Time) *model.HistogramBucket {
+	ms := millis(t)
+	b, ok := buckets[ms]
+	if !ok {
+		b = &model.HistogramBucket{Time: ms, Levels: make(map[string]int)}
+		buckets[ms] = b
+	}
+	return b
+}
+
+//autoInterval shortest interval with at most HistogramMaxAutoBuckets buckets over time span
+func autoInterval(buckets map[int64]*model.HistogramBucket) string {
+	if len(buckets) == 0 {
+		return model.HistogramMinute
+	}
+	first, last := span(buckets)
+	for _, i := range intervals[:len(intervals)-1] {
+		if last.Sub(first)/length(i) < model.HistogramMaxAutoBuckets {
+			return i
+		}
+	}
+	return model.HistogramDay
+}
+
+//merge merges buckets into buckets of longer interval
+func merge(buckets map[int64]*model.HistogramBucket, interval string) map[int64]*model.HistogramBucket {
+	merged := make(map[int64]*model.HistogramBucket)
+	for ms, b := range buckets {
+		m := bucket(merged, start(fromMillis(ms), interval))
+		m.Total += b.Total
+		for l, c := range b.Levels {
+			m.Levels[l] += c
+		}
+	}
+	return merged
+}
+
+//fill buckets ordered by time with empty buckets between first and last
+func fill(buckets map[int64]*model.HistogramBucket, interval string) ([]model.HistogramBucket, error) {
+	res := make([]model.HistogramBucket, 0, len(buckets))
+	if len(buckets) == 0 {
+		return res, nil
+	}
+	first, last := span(buckets)
+	if n := last.Sub(first) / length(interval); n >= time.Duration(maxBuckets) {
+		return nil, fmt.Errorf("Histogram with %v interval has more than %v buckets, use longer interval or time range", interval, maxBuckets)
+	}
+	for t := first; !t.After(last); {
+		if b, ok := buckets[millis(t)]; ok {
+			res = append(res, *b)
+		} else {
+			res = append(res, model.HistogramBucket{Time: millis(t), Levels: map[string]int{}})
+		}
+		n := next(t, interval)
+		if !n.After(t) {
+			return nil, fmt.Errorf("Could not step %v histogram bucket after %v", interval, t)
+		}
+		t = n
+	}
+	return res, nil
+}
+
+//span starts of first and last bucket
+func span(buckets map[int64]*model.HistogramBucket) (time.Time, time.Time) {
+	keys := make([]int64, 0, len(buckets))
+	for ms := range buckets {
+		keys = append(keys, ms)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return fromMillis(keys[0]), fromMillis(keys[len(keys)-1])
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -1,56 +1,45 @@
 package stat
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	l "github.com/RomanLorens/logger/log"
 	"github.com/RomanLorens/logviewer-module/model"
+	"github.com/RomanLorens/logviewer-module/parser"
 	"github.com/RomanLorens/logviewer-module/search"
 )
 
 //Errors errors
 func Errors(req *model.ErrorsRequest) (*model.ErrorDetailsPagination, error) {
-	file, err := os.Open(req.Log)
+	files, err := search.LogFiles(req.Log, req.History)
 	if err != nil {
-		return nil, fmt.Errorf("Could not open log file, %v", err)
+		return nil, err
 	}
-	defer file.Close()
+	ls := req.LogStructure
 	res := make([]model.ErrorDetails, 0, 100)
 	requests := make(map[string]int, 0)
-	scanner := bufio.NewScanner(file)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-	ls := req.LogStructure
-	maxTokens := max(ls)
-	for scanner.Scan() {
-		tokens := strings.Split(scanner.Text(), "|")
-		if len(tokens) < maxTokens {
-			continue
-		}
-		level := search.NormalizeText(tokens[ls.Level])
+	err = scanRecords(files, ls, search.NewTimeRange(req.FromTime, req.ToTime), func(rec *parser.Record) {
+		level := search.NormalizeText(rec.Level)
 		if !(level == "ERROR" || level == "WARNING" || level == "WARN") {
-			continue
+			return
 		}
-		requests[tokens[ls.Reqid]+level]++
-		if requests[tokens[ls.Reqid]+level] > 1 {
-			continue
+		requests[rec.ReqID+level]++
+		if requests[rec.ReqID+level] > 1 {
+			return
 		}
 
 		res = append(res, model.ErrorDetails{
-			ReqID:   model.ReqID{ReqID: tokens[ls.Reqid], Date: tokens[ls.Date]},
+			ReqID:   model.ReqID{ReqID: rec.ReqID, Date: rec.Date},
 			Level:   level,
-			Message: tokens[ls.Message],
-			User:    tokens[ls.User],
+			Message: rec.Message,
+			User:    rec.User,
 		})
-
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("Error from scanner, %v", err)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
@@ -73,30 +62,9 @@ func Errors(req *model.ErrorsRequest) (*model.ErrorDetailsPagination, error) {
 	return &model.ErrorDetailsPagination{ErrorDetails: res[start:end], Pagination: pagination}, nil
 }
 
-func getFilesByPattern(log string) ([]string, error) {
-	dir := filepath.Dir(log)
-	info, err := os.Stat(dir)
-	if err != nil {
-		return nil, fmt.Errorf("Could not open dir %v, %v", dir, err)
-	}
-	if !info.IsDir() {
-		return nil, fmt.Errorf("%v is not dir, %v", dir, info)
-	}
-	pattern := strings.Replace(filepath.Base(log), ".log", "", 1)
-	paths := make([]string, 0, 1)
-	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
-		if fi.IsDir() || !strings.Contains(path, pattern) {
-			return nil
-		}
-		paths = append(paths, path)
-		return nil
-	})
-	return paths, nil
-}
-
 //CollectStats collects stats
 func CollectStats(ctx context.Context, req *model.CollectStatsRequest, logger l.Logger) (*model.CollectStatsRsults, error) {
-	paths, err := getFilesByPattern(req.Log)
+	paths, err := search.RotationChain(req.Log)
 	if err != nil {
 		return nil, err
 	}
@@ -104,72 +72,76 @@ func CollectStats(ctx context.Context, req *model.CollectStatsRequest, logger l.
 	//user -> level -> counter
 	m := make(map[string]map[string]int)
 	requests := make(map[string]int, 0)
-	for _, p := range paths {
-		file, err := os.Open(p)
-		if err != nil {
-			return nil, fmt.Errorf("Could not open log file, %v", err)
-		}
-		defer file.Close()
-		ls := req.LogStructure
-		maxTokens := max(ls)
-		scanner := bufio.NewScanner(file)
-		buf := make([]byte, 0, 64*1024)
-		scanner.Buffer(buf, 1024*1024)
-		for scanner.Scan() {
-			tokens := strings.Split(scanner.Text(), "|")
-			if len(tokens) < maxTokens {
-				continue
-			}
-			if !strings.Contains(tokens[ls.Date], req.Date) {
-				continue
-			}
-			user := tokens[ls.User]
-			if len(strings.TrimSpace(user)) == 0 {
-				continue
-			}
-			level := strings.ToUpper(search.NormalizeText(tokens[ls.Level]))
-			key := tokens[ls.Reqid] + level + user
-			requests[key]++
-			if requests[key] > 1 {
-				continue
-			}
-			u, ok := m[user]
-			if !ok {
-				u = make(map[string]int, 0)
-				m[user] = u
-			}
-			u[level]++
+	ls := req.LogStructure
+	tr, inDay := dayRange(req.Date, ls, search.NewTimeRange(req.FromTime, req.ToTime))
+	err = scanRecords(paths, ls, tr, func(rec *parser.Record) {
+		if !inDay && !strings.Contains(rec.Date, req.Date) {
+			return
 		}
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("Error from scanner, %v", err)
+		user := rec.User
+		if len(strings.TrimSpace(user)) == 0 {
+			return
+		}
+		level := strings.ToUpper(search.NormalizeText(rec.Level))
+		key := rec.ReqID + level + user
+		requests[key]++
+		if requests[key] > 1 {
+			return
 		}
+		u, ok := m[user]
+		if !ok {
+			u = make(map[string]int, 0)
+			m[user] = u
+		}
+		u[level]++
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &model.CollectStatsRsults{Users: m, TotalRequests: int32(len(requests))}, nil
 }
 
+//dayRange time range narrowed to [day start, day end) of date in log date format or yyyy-MM-dd,
+//false when log structure has no date format or date does not parse so date is matched as text
+func dayRange(date string, ls *model.LogStructure, tr search.TimeRange) (search.TimeRange, bool) {
+	if date == "" {
+		return tr, true
+	}
+	if search.DateLayout(ls) == "" {
+		return tr, false
+	}
+	t, err := search.ParseTime(date, ls)
+	if err != nil {
+		if t, err = search.ParseTime(date, &model.LogStructure{DateFormat: "2006-01-02"}); err != nil {
+			return tr, false
+		}
+	}
+	y, m, d := t.Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	to := from.AddDate(0, 0, 1)
+	if tr.From.IsZero() || tr.From.Before(from) {
+		tr.From = from
+	}
+	if tr.To.IsZero() || tr.To.After(to) {
+		tr.To = to
+	}
+	return tr, true
+}
+
 //Stats stats
-func Stats(log string, ls *model.LogStructure) (map[string]*model.Stat, error) {
+func Stats(req *model.StatsRequest) (map[string]*model.Stat, error) {
 	out := make(map[string]*model.Stat)
 	requests := make(map[string]int, 0)
-	file, err := os.Open(log)
+	files, err := search.LogFiles(req.Log, req.History)
 	if err != nil {
-		return nil, fmt.Errorf("Could not open log file, %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	maxTokens := max(ls)
-	scanner := bufio.NewScanner(file)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-	for scanner.Scan() {
-		tokens := strings.Split(scanner.Text(), "|")
-		if len(tokens) < maxTokens {
-			continue
-		}
-		user := tokens[ls.User]
+	ls := req.LogStructure
+	err = scanRecords(files, ls, search.NewTimeRange(req.FromTime, req.ToTime), func(rec *parser.Record) {
+		user := rec.User
 		if len(strings.TrimSpace(user)) == 0 {
-			continue
+			return
 		}
 		u, ok := out[user]
 		if !ok {
@@ -178,26 +150,26 @@ func Stats(log string, ls *model.LogStructure) (map[string]*model.Stat, error) {
 			}
 			out[user] = u
 		}
-		level := strings.ToUpper(search.NormalizeText(tokens[ls.Level]))
-		key := tokens[ls.Reqid] + level + user
+		level := strings.ToUpper(search.NormalizeText(rec.Level))
+		key := rec.ReqID + level + user
 		requests[key]++
 		if requests[key] > 1 {
-			continue
+			return
 		}
-		u.LastTime = tokens[ls.Date]
+		u.LastTime = rec.Date
 		u.Counter++
 		u.Levels[level]++
 		if level == "ERROR" {
-			u.Errors = append(u.Errors, model.ReqID{ReqID: tokens[ls.Reqid], Date: tokens[ls.Date]})
+			u.Errors = append(u.Errors, model.ReqID{ReqID: rec.ReqID, Date: rec.Date})
 		}
 		if level == "WARNING" || level == "WARN" {
 			u.Warnings = append(u.Warnings, model.ReqID{
-				ReqID: tokens[ls.Reqid], Date: tokens[ls.Date],
+				ReqID: rec.ReqID, Date: rec.Date,
 			})
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("Error from scanner, %v", err)
+	})
+	if err != nil {
+		return nil, err
 	}
 	for _, v := range out {
 		for i, j := 0, len(v.Errors)-1; i < j; i, j = i+1, j-1 {
@@ -211,16 +183,29 @@ func Stats(log string, ls *model.LogStructure) (map[string]*model.Stat, error) {
 	return out, nil
 }
 
-func max(ls *model.LogStructure) int {
-	m := ls.Date
-	if ls.User > m {
-		m = ls.User
-	}
-	if ls.Reqid > m {
-		m = ls.Reqid
+//scanRecords passes every complete record of files with log structure, in order, to fn
+func scanRecords(files []string, ls *model.LogStructure, tr search.TimeRange, fn func(rec *parser.Record)) error {
+	p, err := parser.Of(ls)
+	if err != nil {
+		return err
 	}
-	if ls.Level > m {
-		m = ls.Level
+	for _, f := range files {
+		scanner, file, err := search.OpenRecords(f, ls, tr)
+		if err != nil {
+			return fmt.Errorf("Could not open log file, %v", err)
+		}
+		for scanner.Scan() {
+			rec, ok := p.Parse(scanner.Record().Text)
+			if !ok {
+				continue
+			}
+			fn(rec)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("Error from scanner, %v", err)
+		}
 	}
-	return m
+	return nil
 }